@@ -1,30 +1,135 @@
 package Config
 
 import (
+	"fmt"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
-	"log"
+	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 )
 
-//should be able to set config path value maybe as enviroment varible or command line option then default to this const
-const path = "/home/chinz/go/src/DiscordVoiceRecognition/config.yml"
+//DefaultPath is used when neither the -config flag or LYDIA_CONFIG are set
+const DefaultPath = "config.yml"
+
+//PathEnvironmentVariable is checked for the config path when it hasn't been set with SetPath
+const PathEnvironmentVariable = "LYDIA_CONFIG"
+
+//the shared config. everything reads it through LoadConfig so a reload is picked up on the next call
+var (
+	mutex   sync.RWMutex
+	path    string
+	current *Config
+)
 
 //might want to split this out into more fine grained structs
 type Config struct {
 	Discord struct {
-		Token        string `yaml:"token"`
+		Token string `yaml:"token"`
+		//Follow waits for users to summon the bot with /lydia join instead of joining channels at startup.
+		//Channels are only used for their settings when following
+		Follow bool `yaml:"follow"`
+		//Guild, VoiceChannel and TextChannel are the channel joined when Channels is empty
 		Guild        string `yaml:"guild"`
 		VoiceChannel string `yaml:"voicechannel"`
 		TextChannel  string `yaml:"textchannel"`
+		//Channels are every voice channel to join, each one listens and answers separately
+		Channels []DiscordChannel `yaml:"channels"`
+		//Mirror posts what was heard and answered to the text channel
+		Mirror struct {
+			Enabled bool `yaml:"enabled"`
+			//Guilds turns mirroring on or off for a guild instead of using Enabled
+			Guilds map[string]bool `yaml:"guilds"`
+		}
 	}
 	Sphinx struct {
 		HMM          string `yaml:"hmm"`
 		Dict         string `yaml:"dict"`
 		KeywordsFile string `yaml:"keywordsfile"`
 		LogFile      string `yaml:"logfile"`
+		//keywordsModified is when the keywords file was changed so editing it counts as a sphinx change
+		keywordsModified time.Time
 	}
 	GoogleServices struct {
 		CredentialsFile string `yaml:"credentialsfile"`
+		//Endpoint replaces the google address for speech and text to speech e.g. a local stand in
+		Endpoint string `yaml:"endpoint"`
+		//Insecure connects to the endpoint without tls or credentials
+		Insecure bool `yaml:"insecure"`
+	}
+	SpeechToText struct {
+		//google, vosk, whisper or sphinx. google is the default if not set
+		Provider string `yaml:"provider"`
+		//Fallback is used when the provider can't start listening e.g. google is unreachable
+		Fallback string `yaml:"fallback"`
+		Language string `yaml:"language"`
+		Vosk     struct {
+			Model  string `yaml:"model"`
+			Server string `yaml:"server"`
+		}
+		Whisper struct {
+			Model   string `yaml:"model"`
+			Threads int    `yaml:"threads"`
+		}
+	}
+	TextToSpeech struct {
+		//google, espeak or piper. google is the default if not set
+		Provider string `yaml:"provider"`
+		Language string `yaml:"language"`
+		Google   struct {
+			//Voice is a google voice name e.g. en-GB-Wavenet-A
+			Voice string `yaml:"voice"`
+		}
+		Espeak struct {
+			Command string `yaml:"command"`
+			//Voice is an espeak voice e.g. en-gb
+			Voice string `yaml:"voice"`
+		}
+		Piper struct {
+			Command string `yaml:"command"`
+			Model   string `yaml:"model"`
+		}
+		//Cache keeps synthesized responses on disk. nothing is cached without a directory
+		Cache struct {
+			Directory string `yaml:"directory"`
+			//MaxSize is in megabytes
+			MaxSize int64 `yaml:"maxsize"`
+			//Prewarm phrases are synthesized at startup
+			Prewarm []string `yaml:"prewarm"`
+		}
+	}
+	Commands struct {
+		//MaxConcurrent is how many users can be giving commands at the same time
+		MaxConcurrent int `yaml:"maxconcurrent"`
+		//SpeakTyped reads the answer to typed commands out too when the bot is in the users voice channel
+		SpeakTyped bool `yaml:"speaktyped"`
+		//Activation is how users start giving a command
+		Activation struct {
+			//Mode is wakeword or pushtotalk. wakeword is the default if not set, pushing to talk works in either
+			//but key phrase recognition doesn't run for users set to pushtotalk
+			Mode string `yaml:"mode"`
+			//Window is how long command recognition stays open after pushing to talk
+			Window time.Duration `yaml:"window"`
+			//Guilds and Users replace the mode for a guild or a single user. users come first
+			Guilds map[string]string `yaml:"guilds"`
+			Users  map[string]string `yaml:"users"`
+		}
+		//RateLimits stop a single user or guild using up the speech and text to speech quota
+		RateLimits struct {
+			Users  RateLimits `yaml:"users"`
+			Guilds RateLimits `yaml:"guilds"`
+			//Cooldown is read out instead when a user or guild is over a limit
+			Cooldown string `yaml:"cooldown"`
+		}
+		//Timeouts are how long a command can stay in each step, anything not set uses the default
+		Timeouts struct {
+			Wake          time.Duration `yaml:"wake"`
+			Listening     time.Duration `yaml:"listening"`
+			Understanding time.Duration `yaml:"understanding"`
+			Responding    time.Duration `yaml:"responding"`
+			FollowUp      time.Duration `yaml:"followup"`
+		}
 	}
 	Rasa struct {
 		Scheme   string `yaml:"scheme"`
@@ -33,31 +138,268 @@ type Config struct {
 		Project  string `yaml:"project"`
 		Language string `yaml:"language"`
 		Pipeline string `yaml:"pipeline"`
+		//examples used to train rasa and to build the sphinx command grammar
+		TrainingData string `yaml:"trainingdata"`
+	}
+	Dialogue struct {
+		//Intents maps an intent name to the entities it needs before going to the remote bot
+		Intents map[string]DialogueIntent `yaml:"intents"`
 	}
 	RemoteBot struct {
 		Address string `yaml:"address"`
 	}
+	//Permissions limit who can use intents and remote bots in each guild
+	Permissions struct {
+		GuildPermissions `yaml:",inline"`
+		//File keeps the permissions given with /lydia permissions, they are added to the ones here
+		File string `yaml:"file"`
+		//granted are the permissions loaded from File
+		granted GuildPermissions
+	}
 	Log struct {
 		Path string `yaml:"path"`
 	}
 }
 
+//DiscordChannel is a voice channel to join. settings that aren't set use the global ones
+type DiscordChannel struct {
+	Guild        string `yaml:"guild"`
+	VoiceChannel string `yaml:"voicechannel"`
+	TextChannel  string `yaml:"textchannel"`
+	//RemoteBot replaces remotebot.address for commands from this channel
+	RemoteBot string `yaml:"remotebot"`
+	//MaxConcurrent replaces commands.maxconcurrent
+	MaxConcurrent int `yaml:"maxconcurrent"`
+}
+
+//DiscordChannels are the channels to join, the single guild and voice channel under discord are used
+//if none are listed
+func (config Config) DiscordChannels() []DiscordChannel {
+	channels := config.Discord.Channels
+	if len(channels) == 0 {
+		channels = []DiscordChannel{{
+			Guild:        config.Discord.Guild,
+			VoiceChannel: config.Discord.VoiceChannel,
+			TextChannel:  config.Discord.TextChannel,
+		}}
+	}
+	filled := make([]DiscordChannel, len(channels))
+	for i, channel := range channels {
+		filled[i] = config.fillChannel(channel)
+	}
+	return filled
+}
+
+//DiscordChannel finds the settings for a voice channel with the global settings filled in
+func (config Config) DiscordChannel(guildId string, voiceChannelId string) DiscordChannel {
+	for _, channel := range config.DiscordChannels() {
+		if channel.Guild == guildId && channel.VoiceChannel == voiceChannelId {
+			return channel
+		}
+	}
+	return config.fillChannel(DiscordChannel{Guild: guildId, VoiceChannel: voiceChannelId})
+}
+
+func (config Config) fillChannel(channel DiscordChannel) DiscordChannel {
+	//the text channel is only shared by channels in its guild
+	if channel.TextChannel == "" && channel.Guild == config.Discord.Guild {
+		channel.TextChannel = config.Discord.TextChannel
+	}
+	if channel.RemoteBot == "" {
+		channel.RemoteBot = config.RemoteBot.Address
+	}
+	if channel.MaxConcurrent == 0 {
+		channel.MaxConcurrent = config.Commands.MaxConcurrent
+	}
+	return channel
+}
+
+//Mirrored is true if interactions in the guild are posted to the text channel
+func (config Config) Mirrored(guildId string) bool {
+	if mirrored, exists := config.Discord.Mirror.Guilds[guildId]; exists {
+		return mirrored
+	}
+	return config.Discord.Mirror.Enabled
+}
+
+//activation modes, see Commands.Activation
+const (
+	WakeWord   = "wakeword"
+	PushToTalk = "pushtotalk"
+)
+
+//ActivationMode is how the user starts giving a command in the guild, either WakeWord or PushToTalk
+func (config Config) ActivationMode(guildId string, userId string) string {
+	if mode, exists := config.Commands.Activation.Users[userId]; exists {
+		return mode
+	}
+	if mode, exists := config.Commands.Activation.Guilds[guildId]; exists {
+		return mode
+	}
+	if config.Commands.Activation.Mode == "" {
+		return WakeWord
+	}
+	return config.Commands.Activation.Mode
+}
+
+//RateLimits are token buckets for each user or guild
+type RateLimits struct {
+	//Sessions are commands started with the wake word or by pushing to talk
+	Sessions RateLimit `yaml:"sessions"`
+	//RemoteBot are commands sent to the remote bot, typed ones included
+	RemoteBot RateLimit `yaml:"remotebot"`
+}
+
+//RateLimit adds Rate tokens every Per up to Burst, each use takes one. nothing is limited without a rate
+type RateLimit struct {
+	Rate int `yaml:"rate"`
+	//Per is a minute if not set
+	Per time.Duration `yaml:"per"`
+	//Burst is how many can be used straight away, Rate if not set
+	Burst int `yaml:"burst"`
+}
+
+type DialogueIntent struct {
+	//Slots are asked for in order until every entity has a value
+	Slots []DialogueSlot `yaml:"slots"`
+}
+
+type DialogueSlot struct {
+	Entity string `yaml:"entity"`
+	//Prompt is read out to ask the user for the entity
+	Prompt string `yaml:"prompt"`
+}
+
+//SetPath changes where the config is loaded from. a config already loaded from another path is read
+//again the next time it is loaded
+func SetPath(configPath string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if configPath != path {
+		current = nil
+	}
+	path = configPath
+}
+
+//Path is the path set with SetPath, LYDIA_CONFIG or the default
+func Path() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if path != "" {
+		return path
+	}
+	if environmentPath := os.Getenv(PathEnvironmentVariable); environmentPath != "" {
+		return environmentPath
+	}
+	return DefaultPath
+}
+
+//LoadConfig returns the shared config. it is only read from disk the first time, after that Watch keeps
+//it up to date. use Load the first time so a broken config can be reported
 func LoadConfig() Config {
-	var config Config
-	file, err := os.Open(path)
+	config, err := Load()
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	return config
+}
+
+//Load is LoadConfig with the error returned. the config is returned even when it has problems so the
+//logs can be set up from it first
+func Load() (Config, error) {
+	mutex.RLock()
+	if current != nil {
+		config := *current
+		mutex.RUnlock()
+		return config, nil
+	}
+	mutex.RUnlock()
+	configPath := Path()
+	config, err := Read(configPath)
 	if err != nil {
-		log.Fatalf("Failed to open config file located at %s", path)
+		return config, err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if current == nil {
+		current = &config
 	}
-	fileInfo, err := file.Stat()
+	return *current, nil
+}
+
+//Read loads a config file without changing the shared config. environment overrides are applied on top.
+//the config is checked for mistakes but not whether the files it points at exist, use Check for that
+func Read(configPath string) (Config, error) {
+	config, problems, err := read(configPath)
 	if err != nil {
-		log.Fatalf("Failed to stat config file located at %s", path)
+		return config, err
+	}
+	return config, append(problems, formatProblems(config)...).err(configPath)
+}
+
+//read is Read without checking the config, the problems are environment overrides that couldn't be used
+func read(configPath string) (Config, problems, error) {
+	var config Config
+	buffer, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return config, nil, fmt.Errorf("Failed to open config file located at %s: %s", configPath, err)
 	}
-	fileSize := fileInfo.Size()
-	buffer := make([]byte, fileSize)
-	file.Read(buffer)
 	err = yaml.Unmarshal(buffer, &config)
 	if err != nil {
-		log.Fatalf("Config data is most likely malformed at %s: %s", path, err)
+		return config, nil, fmt.Errorf("Config data is most likely malformed at %s: %s", configPath, err)
 	}
-	return config
+	problems := applyEnvironment(&config)
+	if config.TextToSpeech.Cache.MaxSize == 0 {
+		config.TextToSpeech.Cache.MaxSize = 100
+	}
+	if config.Commands.MaxConcurrent == 0 {
+		config.Commands.MaxConcurrent = 3
+	}
+	if config.Rasa.TrainingData == "" {
+		config.Rasa.TrainingData = "RasaTrainingData/traindata.json"
+	}
+	if config.Commands.RateLimits.Cooldown == "" {
+		config.Commands.RateLimits.Cooldown = "you're giving commands too quickly, try again in a bit"
+	}
+	for _, limit := range []*RateLimit{
+		&config.Commands.RateLimits.Users.Sessions,
+		&config.Commands.RateLimits.Users.RemoteBot,
+		&config.Commands.RateLimits.Guilds.Sessions,
+		&config.Commands.RateLimits.Guilds.RemoteBot,
+	} {
+		if limit.Per == 0 {
+			limit.Per = time.Minute
+		}
+		if limit.Burst == 0 {
+			limit.Burst = limit.Rate
+		}
+	}
+	if config.Permissions.File == "" {
+		config.Permissions.File = DefaultPermissionsFile
+	}
+	config.Permissions.granted, err = ReadPermissionsFile(config.Permissions.File)
+	if err != nil {
+		return config, nil, err
+	}
+	if fileInfo, err := os.Stat(config.Sphinx.KeywordsFile); err == nil {
+		config.Sphinx.keywordsModified = fileInfo.ModTime()
+	}
+	return config, problems, nil
+}
+
+//SphinxChanged is true if key phrase recognition needs rebuilding to pick up the config, including when
+//the keywords file was edited
+func (config Config) SphinxChanged(previous Config) bool {
+	return config.Sphinx.HMM != previous.Sphinx.HMM ||
+		config.Sphinx.Dict != previous.Sphinx.Dict ||
+		config.Sphinx.KeywordsFile != previous.Sphinx.KeywordsFile ||
+		config.Sphinx.LogFile != previous.Sphinx.LogFile ||
+		!config.Sphinx.keywordsModified.Equal(previous.Sphinx.keywordsModified)
+}
+
+//store replaces the shared config
+func store(config Config) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current = &config
 }
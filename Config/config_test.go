@@ -0,0 +1,305 @@
+package Config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, configPath string, contents string) {
+	if err := ioutil.WriteFile(configPath, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//mod times can be coarse so each write is pushed forward to make sure it looks like a change
+func touch(t *testing.T, configPath string, offset time.Duration) {
+	modTime := time.Now().Add(offset)
+	if err := os.Chtimes(configPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func useConfig(t *testing.T, configPath string) {
+	SetPath(configPath)
+	mutex.Lock()
+	current = nil
+	mutex.Unlock()
+	t.Cleanup(func() {
+		SetPath("")
+		mutex.Lock()
+		current = nil
+		mutex.Unlock()
+	})
+}
+
+func TestPath(t *testing.T) {
+	useConfig(t, "")
+	os.Setenv(PathEnvironmentVariable, "/tmp/lydia.yml")
+	defer os.Unsetenv(PathEnvironmentVariable)
+	if Path() != "/tmp/lydia.yml" {
+		t.Errorf("expected the environment variable to be used got %s", Path())
+	}
+	SetPath("other.yml")
+	if Path() != "other.yml" {
+		t.Errorf("expected the set path to win got %s", Path())
+	}
+}
+
+func TestSetPathReloads(t *testing.T) {
+	directory := t.TempDir()
+	first := filepath.Join(directory, "first.yml")
+	second := filepath.Join(directory, "second.yml")
+	writeConfig(t, first, "remotebot:\n  address: http://127.0.0.1:8080/\n")
+	writeConfig(t, second, "remotebot:\n  address: http://127.0.0.1:9090/\n")
+	useConfig(t, first)
+	LoadConfig()
+	SetPath(second)
+	if LoadConfig().RemoteBot.Address != "http://127.0.0.1:9090/" {
+		t.Errorf("expected the config at the new path got %+v", LoadConfig().RemoteBot)
+	}
+}
+
+func TestReadDefaults(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "remotebot:\n  address: http://127.0.0.1:8080/\n")
+	config, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Commands.MaxConcurrent != 3 || config.TextToSpeech.Cache.MaxSize != 100 {
+		t.Errorf("expected defaults to be filled in got %+v", config.Commands)
+	}
+	if limit := config.Commands.RateLimits.Users.Sessions; limit.Per != time.Minute || config.Commands.RateLimits.Cooldown == "" {
+		t.Errorf("expected rate limit defaults to be filled in got %+v", config.Commands.RateLimits)
+	}
+	writeConfig(t, configPath, "remotebot:\n  address: not a url\n")
+	if _, err := Read(configPath); err == nil {
+		t.Error("expected an invalid remote bot address to be rejected")
+	}
+}
+
+func TestLoadReturnsProblems(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "discord:\n  token: secret-token\n")
+	useConfig(t, configPath)
+	os.Setenv("LYDIA_COMMANDS_MAXCONCURRENT", "lots")
+	defer os.Unsetenv("LYDIA_COMMANDS_MAXCONCURRENT")
+	config, err := Load()
+	if !problemFields(t, err)["commands.maxconcurrent"] {
+		t.Errorf("expected the problem to be returned got %v", err)
+	}
+	//the token is needed to redact it from the logs the problem is written to
+	if config.Discord.Token != "secret-token" {
+		t.Errorf("expected the config to be returned with the problem got %+v", config.Discord)
+	}
+	os.Unsetenv("LYDIA_COMMANDS_MAXCONCURRENT")
+	if _, err := Load(); err != nil {
+		t.Errorf("expected a broken config not to be kept got %v", err)
+	}
+}
+
+func TestWatchReloads(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "remotebot:\n  address: http://127.0.0.1:8080/\n")
+	useConfig(t, configPath)
+	if LoadConfig().RemoteBot.Address != "http://127.0.0.1:8080/" {
+		t.Fatalf("unexpected config %+v", LoadConfig().RemoteBot)
+	}
+	configNotify := Subscribe()
+	defer Unsubscribe(configNotify)
+	stop := make(chan bool)
+	defer close(stop)
+	go Watch(10*time.Millisecond, stop)
+
+	//a broken config is ignored
+	time.Sleep(50 * time.Millisecond)
+	writeConfig(t, configPath, "remotebot: [\n")
+	touch(t, configPath, time.Second)
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case config := <-configNotify:
+		t.Fatalf("broken config was published %+v", config.RemoteBot)
+	default:
+	}
+	if LoadConfig().RemoteBot.Address != "http://127.0.0.1:8080/" {
+		t.Errorf("expected the previous config to be kept got %+v", LoadConfig().RemoteBot)
+	}
+
+	writeConfig(t, configPath, "remotebot:\n  address: http://127.0.0.1:9090/\n")
+	touch(t, configPath, 2*time.Second)
+	select {
+	case config := <-configNotify:
+		if config.RemoteBot.Address != "http://127.0.0.1:9090/" {
+			t.Errorf("unexpected reloaded config %+v", config.RemoteBot)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was never reloaded")
+	}
+	if LoadConfig().RemoteBot.Address != "http://127.0.0.1:9090/" {
+		t.Errorf("expected the shared config to be replaced got %+v", LoadConfig().RemoteBot)
+	}
+}
+
+func TestSphinxChanged(t *testing.T) {
+	directory := t.TempDir()
+	keywordsPath := filepath.Join(directory, "keyphrase.kws")
+	writeConfig(t, keywordsPath, "hey lydia /1e-20/\n")
+	configPath := filepath.Join(directory, "config.yml")
+	writeConfig(t, configPath, "sphinx:\n  keywordsfile: "+keywordsPath+"\n")
+	previous, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.RemoteBot.Address = "http://127.0.0.1:9090/"
+	if config.SphinxChanged(previous) {
+		t.Error("expected a config with the same sphinx settings not to need rebuilding")
+	}
+	touch(t, keywordsPath, time.Second)
+	if config, err = Read(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if !config.SphinxChanged(previous) {
+		t.Error("expected an edited keywords file to need rebuilding")
+	}
+}
+
+func TestEnvironmentOverrides(t *testing.T) {
+	directory := t.TempDir()
+	configPath := filepath.Join(directory, "config.yml")
+	writeConfig(t, configPath, "discord:\n  token: from-file\n  guild: 1\nspeechtotext:\n  vosk:\n    server: ws://127.0.0.1:2700\n")
+	tokenPath := filepath.Join(directory, "token")
+	writeConfig(t, tokenPath, "from-secret\n")
+	for name, value := range map[string]string{
+		"LYDIA_DISCORD_TOKEN_FILE":          tokenPath,
+		"LYDIA_DISCORD_GUILD":               "2",
+		"LYDIA_SPEECHTOTEXT_VOSK_SERVER":    "ws://vosk:2700",
+		"LYDIA_GOOGLESERVICES_INSECURE":     "true",
+		"LYDIA_COMMANDS_MAXCONCURRENT":      "5",
+		"LYDIA_COMMANDS_TIMEOUTS_LISTENING": "30s",
+		"LYDIA_TEXTTOSPEECH_CACHE_PREWARM":  "hello, which sound?",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	config, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Discord.Token != "from-secret" || config.Discord.Guild != "2" || config.SpeechToText.Vosk.Server != "ws://vosk:2700" {
+		t.Errorf("expected string overrides got %+v %+v", config.Discord, config.SpeechToText.Vosk)
+	}
+	if !config.GoogleServices.Insecure || config.Commands.MaxConcurrent != 5 || config.Commands.Timeouts.Listening != 30*time.Second {
+		t.Errorf("expected typed overrides got %+v %+v", config.GoogleServices, config.Commands)
+	}
+	if len(config.TextToSpeech.Cache.Prewarm) != 2 || config.TextToSpeech.Cache.Prewarm[1] != "which sound?" {
+		t.Errorf("expected a list override got %q", config.TextToSpeech.Cache.Prewarm)
+	}
+	//the variable wins over the secret file
+	os.Setenv("LYDIA_DISCORD_TOKEN", "from-environment")
+	defer os.Unsetenv("LYDIA_DISCORD_TOKEN")
+	if config, _ := Read(configPath); config.Discord.Token != "from-environment" {
+		t.Errorf("expected the environment token got %s", config.Discord.Token)
+	}
+}
+
+func TestEnvironmentOverridesYaml(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "discord:\n  token: token\n")
+	for name, value := range map[string]string{
+		"LYDIA_DISCORD_CHANNELS":          "[{guild: 1, voicechannel: 2, textchannel: 3}]",
+		"LYDIA_COMMANDS_ACTIVATION_USERS": "{\"4\": pushtotalk}",
+		"LYDIA_DISCORD_MIRROR_GUILDS":     "{\"1\": true}",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	config, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Discord.Channels) != 1 || config.Discord.Channels[0].VoiceChannel != "2" {
+		t.Errorf("expected the channels override got %+v", config.Discord.Channels)
+	}
+	if config.Commands.Activation.Users["4"] != "pushtotalk" || !config.Discord.Mirror.Guilds["1"] {
+		t.Errorf("expected the map overrides got %v %v", config.Commands.Activation.Users, config.Discord.Mirror.Guilds)
+	}
+	os.Setenv("LYDIA_DISCORD_CHANNELS", "[guild: 1")
+	if _, err := Read(configPath); !problemFields(t, err)["discord.channels"] {
+		t.Errorf("expected bad yaml to be reported got %v", err)
+	}
+}
+
+func TestEnvironmentOverrideProblems(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "commands:\n  maxconcurrent: 2\n")
+	os.Setenv("LYDIA_COMMANDS_MAXCONCURRENT", "lots")
+	defer os.Unsetenv("LYDIA_COMMANDS_MAXCONCURRENT")
+	os.Setenv("LYDIA_DISCORD_TOKEN_FILE", "/missing/token")
+	defer os.Unsetenv("LYDIA_DISCORD_TOKEN_FILE")
+	_, err := Read(configPath)
+	fields := problemFields(t, err)
+	if !fields["commands.maxconcurrent"] || !fields["discord.token"] {
+		t.Errorf("expected both overrides to be reported got %v", fields)
+	}
+}
+
+func TestDiscordChannels(t *testing.T) {
+	var config Config
+	config.Discord.Guild = "1"
+	config.Discord.VoiceChannel = "2"
+	config.RemoteBot.Address = "http://127.0.0.1:8080/"
+	config.Commands.MaxConcurrent = 3
+	channels := config.DiscordChannels()
+	if len(channels) != 1 || channels[0].Guild != "1" || channels[0].VoiceChannel != "2" || channels[0].RemoteBot != "http://127.0.0.1:8080/" {
+		t.Errorf("expected the single channel to be used got %+v", channels)
+	}
+
+	config.Discord.Channels = []DiscordChannel{
+		{Guild: "1", VoiceChannel: "2"},
+		{Guild: "3", VoiceChannel: "4", RemoteBot: "http://127.0.0.1:8081/", MaxConcurrent: 1},
+	}
+	if channels := config.DiscordChannels(); len(channels) != 2 {
+		t.Errorf("expected the listed channels got %+v", channels)
+	}
+	if channel := config.DiscordChannel("1", "2"); channel.RemoteBot != "http://127.0.0.1:8080/" || channel.MaxConcurrent != 3 {
+		t.Errorf("expected the global settings to be filled in got %+v", channel)
+	}
+	if channel := config.DiscordChannel("3", "4"); channel.RemoteBot != "http://127.0.0.1:8081/" || channel.MaxConcurrent != 1 {
+		t.Errorf("expected the channels own settings got %+v", channel)
+	}
+	config.Discord.TextChannel = "5"
+	if channel1, channel3 := config.DiscordChannel("1", "2"), config.DiscordChannel("3", "4"); channel1.TextChannel != "5" || channel3.TextChannel != "" {
+		t.Errorf("expected the text channel to only be shared within its guild got %+v and %+v", channel1, channel3)
+	}
+}
+
+func TestMirrored(t *testing.T) {
+	var config Config
+	config.Discord.Mirror.Enabled = true
+	config.Discord.Mirror.Guilds = map[string]bool{"1": false}
+	if config.Mirrored("1") || !config.Mirrored("2") {
+		t.Errorf("expected guilds to override mirroring")
+	}
+}
+
+func TestActivationMode(t *testing.T) {
+	var config Config
+	if mode := config.ActivationMode("1", "2"); mode != WakeWord {
+		t.Errorf("expected the wake word by default got %s", mode)
+	}
+	config.Commands.Activation.Guilds = map[string]string{"1": PushToTalk}
+	config.Commands.Activation.Users = map[string]string{"3": WakeWord}
+	if mode := config.ActivationMode("1", "2"); mode != PushToTalk {
+		t.Errorf("expected the guilds mode got %s", mode)
+	}
+	if mode := config.ActivationMode("1", "3"); mode != WakeWord {
+		t.Errorf("expected the users mode to come first got %s", mode)
+	}
+}
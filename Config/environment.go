@@ -0,0 +1,133 @@
+package Config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//EnvironmentPrefix starts every override, the rest is the yaml path in capitals joined by underscores
+//e.g. LYDIA_DISCORD_TOKEN or LYDIA_SPEECHTOTEXT_VOSK_SERVER
+const EnvironmentPrefix = "LYDIA_"
+
+//SecretFileSuffix on an override reads the value from a file instead e.g. LYDIA_DISCORD_TOKEN_FILE for
+//docker and kubernetes secrets
+const SecretFileSuffix = "_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+//applyEnvironment replaces config values with any environment overrides. maps and lists of structs
+//like dialogue.intents are written as yaml
+func applyEnvironment(config *Config) problems {
+	var problems problems
+	applyEnvironmentFields(reflect.ValueOf(config).Elem(), nil, &problems)
+	return problems
+}
+
+func applyEnvironmentFields(value reflect.Value, path []string, problems *problems) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		//unexported fields aren't read from yaml either
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), yamlName(field))
+		//inline structs like permissions share the path they are in
+		if strings.Contains(field.Tag.Get("yaml"), ",inline") {
+			fieldPath = path
+		}
+		if field.Type.Kind() == reflect.Struct {
+			applyEnvironmentFields(value.Field(i), fieldPath, problems)
+			continue
+		}
+		override, name, exists, err := environmentOverride(fieldPath)
+		if err != nil {
+			problems.add(strings.Join(fieldPath, "."), "%s", err)
+			continue
+		}
+		if !exists {
+			continue
+		}
+		if err := setField(value.Field(i), override); err != nil {
+			problems.add(strings.Join(fieldPath, "."), "%s %s", name, err)
+		}
+	}
+}
+
+//yaml.v2 uses the lower case field name when there is no tag
+func yamlName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("yaml"), ",")[0]; tag != "" {
+		return tag
+	}
+	return strings.ToLower(field.Name)
+}
+
+//EnvironmentName is the variable that overrides the field at the yaml path e.g. discord.token
+func EnvironmentName(fieldPath string) string {
+	return EnvironmentPrefix + strings.ToUpper(strings.Replace(fieldPath, ".", "_", -1))
+}
+
+//the variable itself wins over a secret file
+func environmentOverride(fieldPath []string) (string, string, bool, error) {
+	name := EnvironmentName(strings.Join(fieldPath, "."))
+	if override, exists := os.LookupEnv(name); exists {
+		return override, name, true, nil
+	}
+	secretFile, exists := os.LookupEnv(name + SecretFileSuffix)
+	if !exists {
+		return "", name, false, nil
+	}
+	secret, err := ioutil.ReadFile(secretFile)
+	if err != nil {
+		return "", name, false, fmt.Errorf("%s%s can't be read: %s", name, SecretFileSuffix, err)
+	}
+	//secret files usually end in a new line that isn't part of the secret
+	return strings.TrimSpace(string(secret)), name + SecretFileSuffix, true, nil
+}
+
+func setField(field reflect.Value, override string) error {
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(override)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.String:
+		field.SetString(override)
+	case field.Kind() == reflect.Bool:
+		value, err := strconv.ParseBool(override)
+		if err != nil {
+			return err
+		}
+		field.SetBool(value)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		value, err := strconv.ParseInt(override, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		//lists are comma separated
+		var values []string
+		for _, value := range strings.Split(override, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		//the same yaml as the config file e.g. [{guild: 1, voicechannel: 2}] for discord.channels
+		value := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(override), value.Interface()); err != nil {
+			return err
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package Config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//DefaultPermissionsFile is where permissions given with /lydia permissions are kept when permissions.file isn't set
+const DefaultPermissionsFile = "permissions.yml"
+
+//GuildPermissions are the permissions for each guild by guild id. role ids only mean something in their own guild
+//so one guild's permissions never affect another's
+type GuildPermissions struct {
+	Guilds map[string]Permissions `yaml:"guilds"`
+}
+
+//Permissions limit intents and remote bots to some roles and users. anything not listed can be used by everyone
+type Permissions struct {
+	//Intents are by intent name
+	Intents map[string]Permission `yaml:"intents"`
+	//RemoteBots are by remote bot address
+	RemoteBots map[string]Permission `yaml:"remotebots"`
+}
+
+//Permission is who can use an intent or remote bot, users need one of the roles or to be listed. nobody can
+//use it when both are empty
+type Permission struct {
+	Roles []string `yaml:"roles"`
+	Users []string `yaml:"users"`
+}
+
+func (permission Permission) merge(other Permission) Permission {
+	return Permission{
+		Roles: appendMissing(append([]string{}, permission.Roles...), other.Roles...),
+		Users: appendMissing(append([]string{}, permission.Users...), other.Users...),
+	}
+}
+
+//Permitted checks the user can use the intent with the remote bot in the guild. roles is only called if either
+//is limited to roles the user isn't listed for and can be nil if the user has no roles
+func (config Config) Permitted(guildId string, intent string, remoteBot string, userId string, roles func() ([]string, error)) (bool, error) {
+	permissions := config.GuildPermissions(guildId)
+	var userRoles []string
+	rolesLooked := false
+	intentPermission, intentLimited := permissions.Intents[intent]
+	remoteBotPermission, remoteBotLimited := permissions.RemoteBots[remoteBot]
+	for _, limit := range []struct {
+		permission Permission
+		limited    bool
+	}{{intentPermission, intentLimited}, {remoteBotPermission, remoteBotLimited}} {
+		permission := limit.permission
+		if !limit.limited || contains(permission.Users, userId) {
+			continue
+		}
+		if !rolesLooked && roles != nil {
+			var err error
+			if userRoles, err = roles(); err != nil {
+				return false, fmt.Errorf("Failed to look up roles for user %s: %s", userId, err)
+			}
+		}
+		rolesLooked = true
+		permitted := false
+		for _, role := range userRoles {
+			if contains(permission.Roles, role) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//GuildPermissions are the guilds permissions in the config with the ones in permissions.file added
+func (config Config) GuildPermissions(guildId string) Permissions {
+	all := Permissions{Intents: make(map[string]Permission), RemoteBots: make(map[string]Permission)}
+	for _, permissions := range []Permissions{config.Permissions.Guilds[guildId], config.Permissions.granted.Guilds[guildId]} {
+		for intent, permission := range permissions.Intents {
+			all.Intents[intent] = all.Intents[intent].merge(permission)
+		}
+		for remoteBot, permission := range permissions.RemoteBots {
+			all.RemoteBots[remoteBot] = all.RemoteBots[remoteBot].merge(permission)
+		}
+	}
+	return all
+}
+
+//Allow lets the role or user use the intent or remote bot. only one of intent and remoteBot and one of
+//roleId and userId are expected to be set
+func (permissions *Permissions) Allow(intent string, remoteBot string, roleId string, userId string) {
+	targets, name := permissions.targets(intent, remoteBot)
+	permission := (*targets)[name]
+	if roleId != "" {
+		permission.Roles = appendMissing(permission.Roles, roleId)
+	}
+	if userId != "" {
+		permission.Users = appendMissing(permission.Users, userId)
+	}
+	(*targets)[name] = permission
+}
+
+//Revoke undoes Allow, it is false if the role or user wasn't allowed. it never opens the intent or remote bot
+//up, once no one is left nobody can use it until Open is used
+func (permissions *Permissions) Revoke(intent string, remoteBot string, roleId string, userId string) bool {
+	targets, name := permissions.targets(intent, remoteBot)
+	permission, exists := (*targets)[name]
+	if !exists {
+		return false
+	}
+	var removed bool
+	if roleId != "" {
+		permission.Roles, removed = remove(permission.Roles, roleId)
+	}
+	if userId != "" {
+		permission.Users, removed = remove(permission.Users, userId)
+	}
+	(*targets)[name] = permission
+	return removed
+}
+
+//Open lets everyone use the intent or remote bot again, it is false if it wasn't limited
+func (permissions *Permissions) Open(intent string, remoteBot string) bool {
+	targets, name := permissions.targets(intent, remoteBot)
+	if _, exists := (*targets)[name]; !exists {
+		return false
+	}
+	delete(*targets, name)
+	return true
+}
+
+//Guild is the guilds permissions, ready to be changed with Allow, Revoke and Open. its maps are shared with
+//permissions so changes to them are kept
+func (permissions *GuildPermissions) Guild(guildId string) *Permissions {
+	if permissions.Guilds == nil {
+		permissions.Guilds = make(map[string]Permissions)
+	}
+	guild := permissions.Guilds[guildId]
+	guild.targets("", "")
+	permissions.Guilds[guildId] = guild
+	return &guild
+}
+
+func (permissions *Permissions) targets(intent string, remoteBot string) (*map[string]Permission, string) {
+	if permissions.Intents == nil {
+		permissions.Intents = make(map[string]Permission)
+	}
+	if permissions.RemoteBots == nil {
+		permissions.RemoteBots = make(map[string]Permission)
+	}
+	if remoteBot != "" {
+		return &permissions.RemoteBots, remoteBot
+	}
+	return &permissions.Intents, intent
+}
+
+//ReadPermissionsFile loads permissions given with /lydia permissions. a file that doesn't exist yet has none
+func ReadPermissionsFile(permissionsPath string) (GuildPermissions, error) {
+	var permissions GuildPermissions
+	buffer, err := ioutil.ReadFile(permissionsPath)
+	if os.IsNotExist(err) {
+		return permissions, nil
+	}
+	if err != nil {
+		return permissions, fmt.Errorf("Failed to open permissions file located at %s: %s", permissionsPath, err)
+	}
+	if err := yaml.Unmarshal(buffer, &permissions); err != nil {
+		return permissions, fmt.Errorf("Permissions data is most likely malformed at %s: %s", permissionsPath, err)
+	}
+	return permissions, nil
+}
+
+//WritePermissionsFile replaces the permissions file. Watch picks the change up like an edit to the config
+func WritePermissionsFile(permissionsPath string, permissions GuildPermissions) error {
+	buffer, err := yaml.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+	//written next to the file then renamed so the watcher never reads half of it
+	temporary, err := ioutil.TempFile(filepath.Dir(permissionsPath), filepath.Base(permissionsPath)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temporary.Write(buffer); err != nil {
+		temporary.Close()
+		os.Remove(temporary.Name())
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return os.Rename(temporary.Name(), permissionsPath)
+}
+
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMissing(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		if !contains(values, addition) {
+			values = append(values, addition)
+		}
+	}
+	return values
+}
+
+func remove(values []string, value string) ([]string, bool) {
+	for i, existing := range values {
+		if existing == value {
+			return append(values[:i:i], values[i+1:]...), true
+		}
+	}
+	return values, false
+}
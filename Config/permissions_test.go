@@ -0,0 +1,103 @@
+package Config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermitted(t *testing.T) {
+	var config Config
+	config.Permissions.Guilds = map[string]Permissions{"guild": {
+		Intents:    map[string]Permission{"playhorn": {Roles: []string{"1"}, Users: []string{"2"}}},
+		RemoteBots: map[string]Permission{"http://admin/": {Roles: []string{"3"}}},
+	}}
+	config.Permissions.granted.Guilds = map[string]Permissions{"guild": {Intents: map[string]Permission{"playhorn": {Users: []string{"4"}}, "lock": {}}}}
+	lookups := 0
+	roles := func(userRoles ...string) func() ([]string, error) {
+		return func() ([]string, error) {
+			lookups++
+			return userRoles, nil
+		}
+	}
+	for _, test := range []struct {
+		intent    string
+		remoteBot string
+		userId    string
+		roles     func() ([]string, error)
+		permitted bool
+	}{
+		{"weather", "http://bot/", "5", nil, true},
+		{"playhorn", "http://bot/", "5", roles("1"), true},
+		{"playhorn", "http://bot/", "5", roles("9"), false},
+		{"playhorn", "http://bot/", "5", nil, false},
+		{"playhorn", "http://bot/", "2", nil, true},
+		{"playhorn", "http://bot/", "4", nil, true},
+		{"playhorn", "http://admin/", "2", roles(), false},
+		{"playhorn", "http://admin/", "2", roles("3"), true},
+		{"weather", "http://admin/", "5", roles("1", "3"), true},
+		{"lock", "http://bot/", "2", roles("1", "3"), false},
+	} {
+		permitted, err := config.Permitted("guild", test.intent, test.remoteBot, test.userId, test.roles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if permitted != test.permitted {
+			t.Errorf("expected user %s permitted %v for %s on %s got %v", test.userId, test.permitted, test.intent, test.remoteBot, permitted)
+		}
+	}
+	//the roles are only needed for the limited remote bot or an intent nobody can use and are looked up once
+	if lookups != 6 {
+		t.Errorf("expected roles to be looked up 6 times got %d", lookups)
+	}
+	//other guilds have their own permissions so a role from this one doesn't limit them
+	if permitted, _ := config.Permitted("other", "playhorn", "http://admin/", "5", nil); !permitted {
+		t.Error("expected another guild not to be limited")
+	}
+	_, err := config.Permitted("guild", "playhorn", "", "5", func() ([]string, error) { return nil, errors.New("no member") })
+	if err == nil {
+		t.Error("expected a failed role lookup to be an error")
+	}
+}
+
+func TestPermissionsFile(t *testing.T) {
+	directory := t.TempDir()
+	permissionsPath := filepath.Join(directory, "permissions.yml")
+	permissions, err := ReadPermissionsFile(permissionsPath)
+	if err != nil {
+		t.Fatalf("expected a missing permissions file to have no permissions got %s", err)
+	}
+	guild := permissions.Guild("123456789012345671")
+	guild.Allow("playhorn", "", "123456789012345678", "")
+	guild.Allow("", "http://admin/", "", "123456789012345679")
+	if err := WritePermissionsFile(permissionsPath, permissions); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(directory, "config.yml")
+	writeConfig(t, configPath, "permissions:\n  file: "+permissionsPath+"\n  guilds:\n    \"123456789012345671\":\n      intents:\n        playhorn:\n          users: [\"123456789012345670\"]\n")
+	config, err := Read(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := config.GuildPermissions("123456789012345671")
+	if len(all.Intents["playhorn"].Roles) != 1 || len(all.Intents["playhorn"].Users) != 1 || len(all.RemoteBots["http://admin/"].Users) != 1 {
+		t.Errorf("expected the permissions file to be added to the config got %+v", all)
+	}
+	if !guild.Revoke("playhorn", "", "123456789012345678", "") {
+		t.Error("expected the allowed role to be revoked")
+	}
+	if guild.Revoke("playhorn", "", "123456789012345678", "") {
+		t.Error("expected revoking twice to do nothing")
+	}
+	//revoking the last role leaves the intent limited to nobody rather than opening it up
+	if _, exists := permissions.Guilds["123456789012345671"].Intents["playhorn"]; !exists {
+		t.Error("expected the intent to stay limited once no one is left")
+	}
+	if !guild.Open("playhorn", "") || guild.Open("playhorn", "") {
+		t.Error("expected the intent to be opened once")
+	}
+	writeConfig(t, permissionsPath, "guilds:\n  \"123456789012345671\":\n    intents:\n      playhorn:\n        roles: [\"role\"]\n")
+	if _, err := Read(configPath); err == nil {
+		t.Error("expected a bad id in the permissions file to be rejected")
+	}
+}
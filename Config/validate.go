@@ -0,0 +1,397 @@
+package Config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Problem is something wrong with one field, the field is the path through the yaml e.g. sphinx.hmm
+type Problem struct {
+	Field   string
+	Message string
+}
+
+//ValidationError has every problem found so they can all be fixed in one go
+type ValidationError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (ve *ValidationError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "config at %s has %d problems:", ve.Path, len(ve.Problems))
+	for _, problem := range ve.Problems {
+		fmt.Fprintf(&builder, "\n  %s: %s", problem.Field, problem.Message)
+	}
+	return builder.String()
+}
+
+type problems []Problem
+
+func (p *problems) add(field string, format string, args ...interface{}) {
+	*p = append(*p, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p problems) err(configPath string) error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Path: configPath, Problems: p}
+}
+
+var (
+	speechToTextProviders = []string{"google", "vosk", "whisper", "sphinx"}
+	textToSpeechProviders = []string{"google", "espeak", "piper"}
+	activationModes       = []string{WakeWord, PushToTalk}
+)
+
+//Validate checks everything needed to join discord and start listening, including that the files the
+//config points at exist. it is run at startup and by validate-config
+func Validate(configPath string, config Config) error {
+	problems := formatProblems(config)
+	problems = append(problems, startupProblems(config)...)
+	return problems.err(configPath)
+}
+
+//Check reads the config like Read then Validates it so every problem is reported together
+func Check(configPath string) (Config, error) {
+	config, problems, err := read(configPath)
+	if err != nil {
+		return config, err
+	}
+	if err := Validate(configPath, config); err != nil {
+		problems = append(problems, err.(*ValidationError).Problems...)
+	}
+	return config, problems.err(configPath)
+}
+
+//formatProblems are mistakes in the config itself. a reloaded config with any of these is ignored
+func formatProblems(config Config) problems {
+	var problems problems
+	checkProvider(&problems, "speechtotext.provider", config.SpeechToText.Provider, speechToTextProviders)
+	checkProvider(&problems, "speechtotext.fallback", config.SpeechToText.Fallback, speechToTextProviders)
+	checkProvider(&problems, "texttospeech.provider", config.TextToSpeech.Provider, textToSpeechProviders)
+	if config.SpeechToText.Whisper.Threads < 0 {
+		problems.add("speechtotext.whisper.threads", "can't be negative")
+	}
+	if config.TextToSpeech.Cache.MaxSize < 0 {
+		problems.add("texttospeech.cache.maxsize", "can't be negative")
+	}
+	if config.Commands.MaxConcurrent < 0 {
+		problems.add("commands.maxconcurrent", "can't be negative")
+	}
+	for field, timeout := range map[string]int64{
+		"commands.timeouts.wake":          int64(config.Commands.Timeouts.Wake),
+		"commands.timeouts.listening":     int64(config.Commands.Timeouts.Listening),
+		"commands.timeouts.understanding": int64(config.Commands.Timeouts.Understanding),
+		"commands.timeouts.responding":    int64(config.Commands.Timeouts.Responding),
+		"commands.timeouts.followup":      int64(config.Commands.Timeouts.FollowUp),
+	} {
+		if timeout < 0 {
+			problems.add(field, "can't be negative")
+		}
+	}
+	checkProvider(&problems, "commands.activation.mode", config.Commands.Activation.Mode, activationModes)
+	if config.Commands.Activation.Window < 0 {
+		problems.add("commands.activation.window", "can't be negative")
+	}
+	for field, limit := range map[string]RateLimit{
+		"commands.ratelimits.users.sessions":   config.Commands.RateLimits.Users.Sessions,
+		"commands.ratelimits.users.remotebot":  config.Commands.RateLimits.Users.RemoteBot,
+		"commands.ratelimits.guilds.sessions":  config.Commands.RateLimits.Guilds.Sessions,
+		"commands.ratelimits.guilds.remotebot": config.Commands.RateLimits.Guilds.RemoteBot,
+	} {
+		if limit.Rate < 0 {
+			problems.add(field+".rate", "can't be negative")
+		}
+		if limit.Per < 0 {
+			problems.add(field+".per", "can't be negative")
+		}
+		if limit.Burst < 0 {
+			problems.add(field+".burst", "can't be negative")
+		}
+	}
+	for _, overrides := range []struct {
+		field string
+		modes map[string]string
+	}{
+		{"commands.activation.guilds", config.Commands.Activation.Guilds},
+		{"commands.activation.users", config.Commands.Activation.Users},
+	} {
+		ids := make([]string, 0, len(overrides.modes))
+		for id := range overrides.modes {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			checkDiscordId(&problems, overrides.field, id, true)
+			checkProvider(&problems, overrides.field+"."+id, overrides.modes[id], activationModes)
+		}
+	}
+	if config.Rasa.Scheme != "" && config.Rasa.Scheme != "http" && config.Rasa.Scheme != "https" {
+		problems.add("rasa.scheme", "must be http or https not %q", config.Rasa.Scheme)
+	}
+	if config.Rasa.Port != "" {
+		if port, err := strconv.Atoi(config.Rasa.Port); err != nil || port <= 0 || port > 65535 {
+			problems.add("rasa.port", "must be a port number not %q", config.Rasa.Port)
+		}
+	}
+	if config.Rasa.Host != "" {
+		if _, err := url.Parse("http://" + config.Rasa.Host); err != nil {
+			problems.add("rasa.host", "%s", err)
+		}
+	}
+	if config.RemoteBot.Address != "" {
+		checkURL(&problems, "remotebot.address", config.RemoteBot.Address)
+	}
+	seen := make(map[string]bool)
+	seenGuilds := make(map[string]bool)
+	for i, channel := range config.Discord.Channels {
+		field := fmt.Sprintf("discord.channels[%d]", i)
+		if channel.RemoteBot != "" {
+			checkURL(&problems, field+".remotebot", channel.RemoteBot)
+		}
+		if channel.MaxConcurrent < 0 {
+			problems.add(field+".maxconcurrent", "can't be negative")
+		}
+		//discord only lets the bot be in one voice channel per guild. when following the channels are only
+		//settings for wherever the bot is summoned so a guild can have several
+		if seen[channel.Guild+"/"+channel.VoiceChannel] {
+			problems.add(field, "voice channel %s is listed more than once", channel.VoiceChannel)
+		} else if seenGuilds[channel.Guild] && !config.Discord.Follow {
+			problems.add(field, "guild %s is listed more than once, the bot can only be in one voice channel per guild", channel.Guild)
+		}
+		seen[channel.Guild+"/"+channel.VoiceChannel] = true
+		seenGuilds[channel.Guild] = true
+	}
+	mirrorGuilds := make([]string, 0, len(config.Discord.Mirror.Guilds))
+	for guild := range config.Discord.Mirror.Guilds {
+		mirrorGuilds = append(mirrorGuilds, guild)
+	}
+	sort.Strings(mirrorGuilds)
+	for _, guild := range mirrorGuilds {
+		checkDiscordId(&problems, "discord.mirror.guilds", guild, true)
+	}
+	checkGuildPermissions(&problems, "permissions", config.Permissions.GuildPermissions)
+	checkGuildPermissions(&problems, config.Permissions.File, config.Permissions.granted)
+	intents := make([]string, 0, len(config.Dialogue.Intents))
+	for intent := range config.Dialogue.Intents {
+		intents = append(intents, intent)
+	}
+	//map order is random so keep the problems in the same order every time
+	sort.Strings(intents)
+	for _, intent := range intents {
+		for i, slot := range config.Dialogue.Intents[intent].Slots {
+			field := fmt.Sprintf("dialogue.intents.%s.slots[%d]", intent, i)
+			if slot.Entity == "" {
+				problems.add(field+".entity", "is required")
+			}
+			if slot.Prompt == "" {
+				problems.add(field+".prompt", "is required")
+			}
+		}
+	}
+	return problems
+}
+
+//startupProblems are settings that have to be there to start and anything outside the config it depends on
+func startupProblems(config Config) problems {
+	var problems problems
+	if config.Discord.Token == "" {
+		problems.add("discord.token", "is required")
+	}
+	//following users can find its channels without any being set
+	if len(config.Discord.Channels) == 0 {
+		checkDiscordId(&problems, "discord.guild", config.Discord.Guild, !config.Discord.Follow)
+		checkDiscordId(&problems, "discord.voicechannel", config.Discord.VoiceChannel, !config.Discord.Follow)
+		checkDiscordId(&problems, "discord.textchannel", config.Discord.TextChannel, false)
+	}
+	for i, channel := range config.Discord.Channels {
+		field := fmt.Sprintf("discord.channels[%d]", i)
+		checkDiscordId(&problems, field+".guild", channel.Guild, true)
+		checkDiscordId(&problems, field+".voicechannel", channel.VoiceChannel, true)
+		checkDiscordId(&problems, field+".textchannel", channel.TextChannel, false)
+	}
+	//channels joined when following are only known once summoned
+	for i, channel := range config.DiscordChannels() {
+		if config.Discord.Follow || !config.Mirrored(channel.Guild) || channel.TextChannel != "" {
+			continue
+		}
+		if len(config.Discord.Channels) == 0 {
+			problems.add("discord.textchannel", "is required when mirroring")
+		} else {
+			problems.add(fmt.Sprintf("discord.channels[%d].textchannel", i), "is required when mirroring")
+		}
+	}
+	if config.Rasa.Scheme == "" {
+		problems.add("rasa.scheme", "is required")
+	}
+	if config.Rasa.Host == "" {
+		problems.add("rasa.host", "is required")
+	}
+	if config.Rasa.Port == "" {
+		problems.add("rasa.port", "is required")
+	}
+	if config.Rasa.Project == "" {
+		problems.add("rasa.project", "is required")
+	}
+	for i, channel := range config.DiscordChannels() {
+		if channel.RemoteBot != "" {
+			continue
+		}
+		if len(config.Discord.Channels) == 0 {
+			problems.add("remotebot.address", "is required")
+		} else {
+			problems.add(fmt.Sprintf("discord.channels[%d].remotebot", i), "is required when remotebot.address isn't set")
+		}
+	}
+	checkPath(&problems, "sphinx.hmm", config.Sphinx.HMM, true)
+	checkPath(&problems, "sphinx.dict", config.Sphinx.Dict, false)
+	checkPath(&problems, "sphinx.keywordsfile", config.Sphinx.KeywordsFile, false)
+	if usesGoogle(config) && !(config.GoogleServices.Endpoint != "" && config.GoogleServices.Insecure) {
+		checkGoogleCredentials(&problems, "googleservices.credentialsfile", config.GoogleServices.CredentialsFile)
+	}
+	return problems
+}
+
+//google is the default provider for both
+func usesGoogle(config Config) bool {
+	for _, provider := range []string{config.SpeechToText.Provider, config.TextToSpeech.Provider} {
+		if provider == "" || provider == "google" {
+			return true
+		}
+	}
+	return config.SpeechToText.Fallback == "google"
+}
+
+//discord ids are snowflakes, the example config uses 0 as a placeholder
+func checkDiscordId(problems *problems, field string, id string, required bool) {
+	if id == "" {
+		if required {
+			problems.add(field, "is required")
+		}
+		return
+	}
+	if snowflake, err := strconv.ParseUint(id, 10, 64); err != nil || snowflake == 0 {
+		problems.add(field, "must be a discord id not %q", id)
+	}
+}
+
+func checkProvider(problems *problems, field string, provider string, providers []string) {
+	if provider == "" {
+		return
+	}
+	for _, known := range providers {
+		if provider == known {
+			return
+		}
+	}
+	problems.add(field, "must be one of %s not %q", strings.Join(providers, ", "), provider)
+}
+
+//field is where the permissions came from, the config or the permissions file
+func checkGuildPermissions(problems *problems, field string, permissions GuildPermissions) {
+	guilds := make([]string, 0, len(permissions.Guilds))
+	for guild := range permissions.Guilds {
+		guilds = append(guilds, guild)
+	}
+	sort.Strings(guilds)
+	for _, guild := range guilds {
+		checkDiscordId(problems, field+".guilds", guild, true)
+		checkPermissions(problems, field+".guilds."+guild, permissions.Guilds[guild])
+	}
+}
+
+func checkPermissions(problems *problems, field string, permissions Permissions) {
+	for _, targets := range []struct {
+		field       string
+		permissions map[string]Permission
+	}{
+		{field + ".intents", permissions.Intents},
+		{field + ".remotebots", permissions.RemoteBots},
+	} {
+		names := make([]string, 0, len(targets.permissions))
+		for name := range targets.permissions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			permission := targets.permissions[name]
+			for _, role := range permission.Roles {
+				checkDiscordId(problems, targets.field+"."+name+".roles", role, true)
+			}
+			for _, user := range permission.Users {
+				checkDiscordId(problems, targets.field+"."+name+".users", user, true)
+			}
+		}
+	}
+	remoteBots := make([]string, 0, len(permissions.RemoteBots))
+	for remoteBot := range permissions.RemoteBots {
+		remoteBots = append(remoteBots, remoteBot)
+	}
+	sort.Strings(remoteBots)
+	for _, remoteBot := range remoteBots {
+		checkURL(problems, field+".remotebots", remoteBot)
+	}
+}
+
+func checkURL(problems *problems, field string, address string) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		problems.add(field, "%s", err)
+		return
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		problems.add(field, "must be an http or https url not %q", address)
+	}
+}
+
+func checkPath(problems *problems, field string, path string, directory bool) {
+	if path == "" {
+		problems.add(field, "is required")
+		return
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		problems.add(field, "%s doesn't exist", path)
+		return
+	}
+	if directory && !fileInfo.IsDir() {
+		problems.add(field, "%s isn't a directory", path)
+	}
+	if !directory && fileInfo.IsDir() {
+		problems.add(field, "%s is a directory", path)
+	}
+}
+
+//the google clients fall back to GOOGLE_APPLICATION_CREDENTIALS when no file is set
+func checkGoogleCredentials(problems *problems, field string, path string) {
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		problems.add(field, "is required when using google")
+		return
+	}
+	credentialsJson, err := ioutil.ReadFile(path)
+	if err != nil {
+		problems.add(field, "%s can't be read", path)
+		return
+	}
+	var credentials struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(credentialsJson, &credentials); err != nil {
+		problems.add(field, "%s isn't a google credentials file: %s", path, err)
+		return
+	}
+	if credentials.Type == "" {
+		problems.add(field, "%s is missing the credentials type", path)
+	}
+}
@@ -0,0 +1,219 @@
+package Config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func problemFields(t *testing.T, err error) map[string]bool {
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, problem := range validationError.Problems {
+		fields[problem.Field] = true
+	}
+	return fields
+}
+
+func validConfig(t *testing.T) Config {
+	directory := t.TempDir()
+	var config Config
+	config.Discord.Token = "token"
+	config.Discord.Guild = "123456789012345678"
+	config.Discord.VoiceChannel = "123456789012345679"
+	config.Sphinx.HMM = directory
+	config.Sphinx.Dict = filepath.Join(directory, "words.dict")
+	config.Sphinx.KeywordsFile = filepath.Join(directory, "keyphrase.kws")
+	config.GoogleServices.CredentialsFile = filepath.Join(directory, "cred.json")
+	for file, contents := range map[string]string{
+		config.Sphinx.Dict:                    "hey HH EY\n",
+		config.Sphinx.KeywordsFile:            "hey/1e-1/\n",
+		config.GoogleServices.CredentialsFile: `{"type": "service_account"}`,
+	} {
+		writeConfig(t, file, contents)
+	}
+	config.Rasa.Scheme = "http"
+	config.Rasa.Host = "127.0.0.1"
+	config.Rasa.Port = "5000"
+	config.Rasa.Project = "project"
+	config.RemoteBot.Address = "http://127.0.0.1:8080/"
+	return config
+}
+
+func TestValidateValid(t *testing.T) {
+	if err := Validate("config.yml", validConfig(t)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, configPath, "rasa:\n  port: rasa\n")
+	os.Setenv("LYDIA_COMMANDS_MAXCONCURRENT", "lots")
+	defer os.Unsetenv("LYDIA_COMMANDS_MAXCONCURRENT")
+	_, err := Check(configPath)
+	fields := problemFields(t, err)
+	for _, field := range []string{"rasa.port", "discord.token", "commands.maxconcurrent"} {
+		if !fields[field] {
+			t.Errorf("expected format, startup and environment problems together, missing %s in %v", field, fields)
+		}
+	}
+	if len(fields) != len(err.(*ValidationError).Problems) {
+		t.Errorf("expected each problem once got %s", err)
+	}
+}
+
+func TestValidateReportsEverything(t *testing.T) {
+	config := validConfig(t)
+	config.Discord.Guild = "0"
+	config.Discord.VoiceChannel = ""
+	os.Remove(config.Sphinx.KeywordsFile)
+	writeConfig(t, config.GoogleServices.CredentialsFile, "not json")
+	config.Rasa.Port = "rasa"
+	config.RemoteBot.Address = "127.0.0.1:8080"
+	config.SpeechToText.Provider = "alexa"
+	config.Dialogue.Intents = map[string]DialogueIntent{"playhorn": {Slots: []DialogueSlot{{Entity: "horntype"}}}}
+	fields := problemFields(t, Validate("config.yml", config))
+	for _, field := range []string{
+		"discord.guild",
+		"discord.voicechannel",
+		"sphinx.keywordsfile",
+		"googleservices.credentialsfile",
+		"rasa.port",
+		"remotebot.address",
+		"speechtotext.provider",
+		"dialogue.intents.playhorn.slots[0].prompt",
+	} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+	if len(fields) != 8 {
+		t.Errorf("expected only the broken fields got %v", fields)
+	}
+}
+
+func TestValidateGoogleCredentialsOnlyWhenUsed(t *testing.T) {
+	config := validConfig(t)
+	config.GoogleServices.CredentialsFile = ""
+	config.SpeechToText.Provider = "vosk"
+	config.TextToSpeech.Provider = "espeak"
+	if err := Validate("config.yml", config); err != nil {
+		t.Error(err)
+	}
+	config.SpeechToText.Fallback = "google"
+	if fields := problemFields(t, Validate("config.yml", config)); !fields["googleservices.credentialsfile"] {
+		t.Errorf("expected google credentials to be needed for the fallback got %v", fields)
+	}
+}
+
+func TestValidateChannels(t *testing.T) {
+	config := validConfig(t)
+	config.Discord.Guild = ""
+	config.Discord.VoiceChannel = ""
+	config.RemoteBot.Address = ""
+	config.Discord.Channels = []DiscordChannel{
+		{Guild: "1", VoiceChannel: "2", RemoteBot: "http://127.0.0.1:8080/"},
+		{Guild: "3", VoiceChannel: "0"},
+		{Guild: "1", VoiceChannel: "2", RemoteBot: "http://127.0.0.1:8080/"},
+		{Guild: "1", VoiceChannel: "4", RemoteBot: "http://127.0.0.1:8080/"},
+	}
+	fields := problemFields(t, Validate("config.yml", config))
+	for _, field := range []string{"discord.channels[1].voicechannel", "discord.channels[1].remotebot", "discord.channels[2]", "discord.channels[3]"} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+	if fields["discord.guild"] || fields["remotebot.address"] {
+		t.Errorf("expected the single channel settings to be optional with channels got %v", fields)
+	}
+	//following only joins one channel at a time so a guild can have settings for several
+	config.Discord.Follow = true
+	config.RemoteBot.Address = "http://127.0.0.1:8080/"
+	config.Discord.Channels = []DiscordChannel{{Guild: "1", VoiceChannel: "2"}, {Guild: "1", VoiceChannel: "4"}}
+	if err := Validate("config.yml", config); err != nil {
+		t.Errorf("expected a guild to have several channels when following got %s", err)
+	}
+}
+
+func TestValidateFollowDoesNotNeedAChannel(t *testing.T) {
+	config := validConfig(t)
+	config.Discord.Guild = ""
+	config.Discord.VoiceChannel = ""
+	config.Discord.Follow = true
+	if err := Validate("config.yml", config); err != nil {
+		t.Errorf("expected following users to not need a voice channel got %v", err)
+	}
+}
+
+func TestValidateMirrorNeedsTextChannel(t *testing.T) {
+	config := validConfig(t)
+	config.Discord.Mirror.Guilds = map[string]bool{config.Discord.Guild: true, "guild": false}
+	fields := problemFields(t, Validate("config.yml", config))
+	for _, field := range []string{"discord.textchannel", "discord.mirror.guilds"} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+	config.Discord.Mirror.Guilds = nil
+	config.Discord.Mirror.Enabled = true
+	config.Discord.TextChannel = "123456789012345680"
+	if err := Validate("config.yml", config); err != nil {
+		t.Errorf("expected mirroring to the text channel to be valid got %v", err)
+	}
+}
+
+func TestValidateActivation(t *testing.T) {
+	config := validConfig(t)
+	config.Commands.Activation.Mode = PushToTalk
+	config.Commands.Activation.Users = map[string]string{"123456789012345678": WakeWord, "user": "clap"}
+	fields := problemFields(t, Validate("config.yml", config))
+	for _, field := range []string{"commands.activation.users", "commands.activation.users.user"} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+	if fields["commands.activation.mode"] || fields["commands.activation.users.123456789012345678"] {
+		t.Errorf("expected the known modes to be valid got %v", fields)
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	config := validConfig(t)
+	config.Permissions.Guilds = map[string]Permissions{
+		"123456789012345671": {
+			Intents: map[string]Permission{
+				"playhorn": {Roles: []string{"123456789012345678"}, Users: []string{"user"}},
+				"weather":  {},
+			},
+			RemoteBots: map[string]Permission{"127.0.0.1:8080": {Users: []string{"123456789012345678"}}},
+		},
+		"guild": {},
+	}
+	fields := problemFields(t, Validate("config.yml", config))
+	guild := "permissions.guilds.123456789012345671"
+	for _, field := range []string{guild + ".intents.playhorn.users", guild + ".remotebots", "permissions.guilds"} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+	if fields[guild+".intents.playhorn.roles"] || fields[guild+".intents.weather"] {
+		t.Errorf("expected the role id and an intent nobody can use to be valid got %v", fields)
+	}
+}
+
+func TestValidateRateLimits(t *testing.T) {
+	config := validConfig(t)
+	config.Commands.RateLimits.Users.Sessions = RateLimit{Rate: -1}
+	config.Commands.RateLimits.Guilds.RemoteBot = RateLimit{Rate: 10, Per: -time.Minute}
+	fields := problemFields(t, Validate("config.yml", config))
+	for _, field := range []string{"commands.ratelimits.users.sessions.rate", "commands.ratelimits.guilds.remotebot.per"} {
+		if !fields[field] {
+			t.Errorf("expected a problem with %s got %v", field, fields)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package Config
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	subscribersMutex sync.Mutex
+	subscribers      = make(map[chan Config]bool)
+)
+
+//Subscribe gets every config Watch reloads. only the latest is kept if the subscriber falls behind
+func Subscribe() <-chan Config {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	configNotify := make(chan Config, 1)
+	subscribers[configNotify] = true
+	return configNotify
+}
+
+func Unsubscribe(configNotify <-chan Config) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for subscriber := range subscribers {
+		if subscriber == configNotify {
+			delete(subscribers, subscriber)
+		}
+	}
+}
+
+func publish(config Config) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for subscriber := range subscribers {
+		//drop a config the subscriber hasn't got to yet since this one replaces it
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- config
+	}
+}
+
+//Watch polls the config file and the sphinx keywords and permissions files it points at and reloads the
+//config when any of them change. a config that doesn't load is logged and the current one kept. returns once stop is closed
+func Watch(interval time.Duration, stop <-chan bool) {
+	configPath := Path()
+	modified := watchedModTimes(configPath, LoadConfig())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		latest := watchedModTimes(configPath, LoadConfig())
+		if !modTimesChanged(modified, latest) {
+			continue
+		}
+		config, err := Read(configPath)
+		if err != nil {
+			zap.S().Warnf("Keeping current config: %s", err)
+			modified = latest
+			continue
+		}
+		store(config)
+		//the new config might point at different keywords or permissions files
+		modified = watchedModTimes(configPath, config)
+		zap.S().Infof("Reloaded config from %s", configPath)
+		publish(config)
+	}
+}
+
+func watchedModTimes(configPath string, config Config) map[string]time.Time {
+	modified := make(map[string]time.Time)
+	for _, watched := range []string{configPath, config.Sphinx.KeywordsFile, config.Permissions.File} {
+		if watched == "" {
+			continue
+		}
+		//missing files have no time so they count as changed once they turn up
+		fileInfo, err := os.Stat(watched)
+		if err != nil {
+			modified[watched] = time.Time{}
+			continue
+		}
+		modified[watched] = fileInfo.ModTime()
+	}
+	return modified
+}
+
+func modTimesChanged(previous map[string]time.Time, latest map[string]time.Time) bool {
+	if len(previous) != len(latest) {
+		return true
+	}
+	for watched, modTime := range latest {
+		if previousModTime, exists := previous[watched]; !exists || !previousModTime.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package GoogleStandIn
+
+import (
+	"context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	texttospeechpb "google.golang.org/genproto/googleapis/cloud/texttospeech/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"sync"
+)
+
+//StandIn is a local grpc server that answers speech and text to speech requests like google
+//would but with scripted responses. point the clients at it with the googleservices endpoint
+//config option and set insecure
+type StandIn struct {
+	speechpb.UnimplementedSpeechServer
+	texttospeechpb.UnimplementedTextToSpeechServer
+	listener          net.Listener
+	server            *grpc.Server
+	mutex             sync.Mutex
+	recognizeScripts  []RecognizeScript
+	synthesizeScripts []SynthesizeScript
+	recognitions      []Recognition
+	synthesizeInputs  []*texttospeechpb.SynthesizeSpeechRequest
+}
+
+//RecognizeScript is how a single StreamingRecognize call is answered
+type RecognizeScript struct {
+	//Responses are sent in order once the first audio has been received
+	Responses []*speechpb.StreamingRecognizeResponse
+	//WaitForClose holds the stream open after the responses until the client stops sending
+	WaitForClose bool
+	//Err ends the stream after the responses. the client sees EOF if it is nil
+	Err error
+}
+
+//SynthesizeScript is how a single SynthesizeSpeech call is answered
+type SynthesizeScript struct {
+	AudioContent []byte
+	Err          error
+}
+
+//Recognition is what the client sent during a StreamingRecognize call
+type Recognition struct {
+	Config *speechpb.StreamingRecognitionConfig
+	Audio  []byte
+}
+
+//CreateStandIn starts serving on address. use 127.0.0.1:0 to pick a free port
+func CreateStandIn(address string) (*StandIn, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	standIn := &StandIn{
+		listener: listener,
+		server:   grpc.NewServer(),
+	}
+	speechpb.RegisterSpeechServer(standIn.server, standIn)
+	texttospeechpb.RegisterTextToSpeechServer(standIn.server, standIn)
+	go standIn.server.Serve(listener)
+	return standIn, nil
+}
+
+//Address is where the stand in is listening
+func (s *StandIn) Address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *StandIn) Close() {
+	s.server.Stop()
+}
+
+//ScriptRecognize queues answers for the next StreamingRecognize calls. a call with nothing
+//queued ends straight away with no results
+func (s *StandIn) ScriptRecognize(scripts ...RecognizeScript) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.recognizeScripts = append(s.recognizeScripts, scripts...)
+}
+
+//ScriptSynthesize queues answers for the next SynthesizeSpeech calls. a call with nothing
+//queued fails as unavailable
+func (s *StandIn) ScriptSynthesize(scripts ...SynthesizeScript) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.synthesizeScripts = append(s.synthesizeScripts, scripts...)
+}
+
+//Recognitions returns every finished StreamingRecognize call in the order they ended
+func (s *StandIn) Recognitions() []Recognition {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Recognition(nil), s.recognitions...)
+}
+
+//SynthesizeRequests returns every SynthesizeSpeech request received
+func (s *StandIn) SynthesizeRequests() []*texttospeechpb.SynthesizeSpeechRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*texttospeechpb.SynthesizeSpeechRequest(nil), s.synthesizeInputs...)
+}
+
+func (s *StandIn) StreamingRecognize(stream speechpb.Speech_StreamingRecognizeServer) error {
+	script := s.nextRecognizeScript()
+	recognition := Recognition{}
+	defer s.recordRecognition(&recognition)
+
+	request, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	recognition.Config = request.GetStreamingConfig()
+	if recognition.Config == nil {
+		return status.Error(codes.InvalidArgument, "the first request must be the streaming config")
+	}
+
+	//google only answers once there is audio to work with
+	clientClosed := false
+	for len(recognition.Audio) == 0 {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			clientClosed = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		recognition.Audio = append(recognition.Audio, request.GetAudioContent()...)
+	}
+	for _, response := range script.Responses {
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+	if script.WaitForClose && !clientClosed {
+		for {
+			request, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			recognition.Audio = append(recognition.Audio, request.GetAudioContent()...)
+		}
+	}
+	return script.Err
+}
+
+func (s *StandIn) SynthesizeSpeech(ctx context.Context, request *texttospeechpb.SynthesizeSpeechRequest) (*texttospeechpb.SynthesizeSpeechResponse, error) {
+	s.mutex.Lock()
+	s.synthesizeInputs = append(s.synthesizeInputs, request)
+	if len(s.synthesizeScripts) == 0 {
+		s.mutex.Unlock()
+		return nil, status.Error(codes.Unavailable, "no synthesize response scripted")
+	}
+	script := s.synthesizeScripts[0]
+	s.synthesizeScripts = s.synthesizeScripts[1:]
+	s.mutex.Unlock()
+	if script.Err != nil {
+		return nil, script.Err
+	}
+	if request.GetInput().GetText() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no text to synthesize")
+	}
+	return &texttospeechpb.SynthesizeSpeechResponse{AudioContent: script.AudioContent}, nil
+}
+
+func (s *StandIn) nextRecognizeScript() RecognizeScript {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.recognizeScripts) == 0 {
+		return RecognizeScript{}
+	}
+	script := s.recognizeScripts[0]
+	s.recognizeScripts = s.recognizeScripts[1:]
+	return script
+}
+
+func (s *StandIn) recordRecognition(recognition *Recognition) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.recognitions = append(s.recognitions, *recognition)
+}
+
+//ErrorResponse is a response carrying an error in the body, the way google reports going over
+//the streaming limits with code 3 or 11
+func ErrorResponse(code codes.Code, message string) *speechpb.StreamingRecognizeResponse {
+	return &speechpb.StreamingRecognizeResponse{
+		Error: status.New(code, message).Proto(),
+	}
+}
+
+//TranscriptResponse is a response with a single result
+func TranscriptResponse(transcript string, final bool, confidence float32) *speechpb.StreamingRecognizeResponse {
+	return &speechpb.StreamingRecognizeResponse{
+		Results: []*speechpb.StreamingRecognitionResult{{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{{
+				Transcript: transcript,
+				Confidence: confidence,
+			}},
+			IsFinal: final,
+		}},
+	}
+}
@@ -40,6 +40,16 @@ func Train(project string, language string, pipeline string, trainData TrainData
 	return nil
 }
 
+func LoadTrainData(path string) (TrainData, error) {
+	trainData := TrainData{}
+	trainDataBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return trainData, err
+	}
+	err = json.Unmarshal(trainDataBytes, &trainData)
+	return trainData, err
+}
+
 func Parse(text string, project string) (*ParserResponse, error) {
 	requestJson, err := json.Marshal(ParserRequest{Query: text, Project: project})
 	if err != nil {
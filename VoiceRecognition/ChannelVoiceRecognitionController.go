@@ -3,129 +3,176 @@ package VoiceRecognition
 import (
 	"DiscordVoiceRecognition/Config"
 	"bytes"
-	"github.com/bwmarrin/discordgo"
+	"context"
+	"fmt"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"time"
 )
 
 type ChannelVoiceRecognitionController struct {
-	session                  *discordgo.Session
-	voiceConnection          *discordgo.VoiceConnection
+	voip                     VOIPService
+	guildId                  string
+	voiceChannelId           string
+	speechToText             SpeechToText
+	textToSpeech             TextToSpeech
 	channelConnectedUsers    *VoiceChannelUsers
-	commandNotify            chan string
-	userSpeakingCommand      uint32
-	commandProcessed         chan bool
-	userDisconnect           chan string
-	userConnect              chan userConnectInfo
+	commandNotify            chan CommandSpokenNotify
+	commandSessions          map[uint32]*CommandSession
+	maxConcurrentCommands    int
+	sessionTimeouts          SessionTimeouts
+	sessionEventNotify       chan sessionEventNotify
+	sessionTimeoutNotify     chan sessionTimeoutNotify
+	playback                 *PlaybackQueue
+	pulsing                  bool
+	pulseStop                chan bool
 	KeywordRecognitionNotify chan KeywordSpokenNotify
-	commandRecognition       *CommandRecognition
-	close                    chan chan bool
+	pipelineEventNotify      chan<- PipelineEvent
+	configNotify             <-chan Config.Config
+	//config is kept for the activation mode of users as they join
+	config           Config.Config
+	pushToTalkNotify chan pushToTalkRequest
+	//pendingPushToTalk are users that pushed to talk before discord said which voice stream is theirs,
+	//by user id with when the window closes
+	pendingPushToTalk map[string]time.Time
+	//cooledDown are users that have been told they're over the session limit, by user id
+	cooledDown map[string]bool
+	close      chan chan bool
+	//stopped is closed once the controller has closed so nothing waits on it forever
+	stopped chan bool
 }
 
+//sounds are loaded relative to the working directory
+var soundsPath = "VoiceRecognition/Sounds/"
+
+//the recognition and processing steps are variables so tests can swap in scripted versions
+//that don't need sphinx or rasa
+var (
+	newKeyPhraseRecognition = createKeyPhraseRecognition
+	newCommandRecognition   = createCommandRecognition
+	processCommand          = commandProcessing
+)
+
 type KeywordSpokenNotify struct {
 	ssrc      uint32
 	keyPhrase string
 }
 
-type userConnectInfo struct {
-	ssrc   uint32
-	userId string
-}
-
 type VoiceInfo struct {
-	packet   *discordgo.Packet
+	packet   *VoicePacket
 	speaking bool
 }
 
-func CreateChannelVoiceRecognitionController() ChannelVoiceRecognitionController {
-	config := Config.LoadConfig()
+//pipelineEventNotify can be nil if nothing needs to follow what the pipeline is doing
+func CreateChannelVoiceRecognitionController(voip VOIPService, speechToText SpeechToText, textToSpeech TextToSpeech, config Config.Config, guildId string, voiceChannelId string, pipelineEventNotify chan<- PipelineEvent) ChannelVoiceRecognitionController {
+	cvr, err := joinChannelVoiceRecognitionController(voip, speechToText, textToSpeech, config, guildId, voiceChannelId, pipelineEventNotify)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	return cvr
+}
+
+//joinChannelVoiceRecognitionController returns an error instead of exiting for channels joined while running
+//where one channel failing shouldn't stop the others
+func joinChannelVoiceRecognitionController(voip VOIPService, speechToText SpeechToText, textToSpeech TextToSpeech, config Config.Config, guildId string, voiceChannelId string, pipelineEventNotify chan<- PipelineEvent) (ChannelVoiceRecognitionController, error) {
 	cvr := ChannelVoiceRecognitionController{
+		voip:                     voip,
+		guildId:                  guildId,
+		voiceChannelId:           voiceChannelId,
+		speechToText:             speechToText,
+		textToSpeech:             textToSpeech,
 		channelConnectedUsers:    createVoiceChannelUsers(),
-		userDisconnect:           make(chan string),
-		userConnect:              make(chan userConnectInfo),
 		KeywordRecognitionNotify: make(chan KeywordSpokenNotify),
-		commandNotify:            make(chan string),
+		commandNotify:            make(chan CommandSpokenNotify),
+		commandSessions:          make(map[uint32]*CommandSession),
+		maxConcurrentCommands:    config.DiscordChannel(guildId, voiceChannelId).MaxConcurrent,
+		sessionTimeouts:          sessionTimeoutsFromConfig(config),
+		sessionEventNotify:       make(chan sessionEventNotify),
+		sessionTimeoutNotify:     make(chan sessionTimeoutNotify),
+		playback:                 createPlaybackQueue(voip),
+		pulseStop:                make(chan bool),
+		pipelineEventNotify:      pipelineEventNotify,
+		config:                   config,
+		pushToTalkNotify:         make(chan pushToTalkRequest),
+		pendingPushToTalk:        make(map[string]time.Time),
+		cooledDown:               make(map[string]bool),
 		close:                    make(chan chan bool),
+		stopped:                  make(chan bool),
 	}
-	zap.S().Info("Connecting to discord")
-	//create discord bot
-	discord, err := discordgo.New("Bot " + config.Discord.Token)
-	if err != nil {
-		zap.S().Fatalf("Error creating Discord session: %s", err)
-	}
-
-	disconnectHandler(discord, cvr.userDisconnect)
-
-	err = discord.Open()
-	if err != nil {
-		zap.S().Fatalf("Error opening Discord session: %s", err)
-	}
-
 	zap.S().Info("joining voice channel")
 	//join voice channel
-	voice, err := discord.ChannelVoiceJoin(config.Discord.Guild, config.Discord.VoiceChannel, false, false)
-	if err != nil {
-		zap.S().Fatalf("Failed to join voice channel: %s", err)
+	if err := voip.Join(guildId, voiceChannelId); err != nil {
+		cvr.playback.Close()
+		return cvr, fmt.Errorf("Failed to join voice channel: %s", err)
 	}
-	connectHandler(voice, cvr.userConnect)
 	//play join sound
-	startupWav, err := ioutil.ReadFile("VoiceRecognition/Sounds/startup.wav")
-	if err != nil {
-		zap.S().Fatal(err)
+	startupWav, err := ioutil.ReadFile(soundsPath + "startup.wav")
+	if err == nil {
+		err = <-cvr.playback.Play(startupWav)
 	}
-
-	err = playWaveAudio(startupWav, voice)
 	if err != nil {
-		zap.S().Fatal(err)
+		cvr.playback.Close()
+		voip.Close()
+		return cvr, err
 	}
+	//only subscribed once joined so a failed join doesn't leave a subscription behind
+	cvr.configNotify = Config.Subscribe()
 
 	//this opus silence is a full silence packet its not the kind discord uses to detect a user speaking or not speaking
 	//this is sent to force the discord connection to start sending voice data
-	cvr.session = discord
-	cvr.voiceConnection = voice
 	go cvr.Start()
-	return cvr
+	return cvr, nil
 }
 
 func (cvr *ChannelVoiceRecognitionController) Start() {
 	unknownUsersSilencePackets := make(map[uint32]int)
-	pulseStop := make(chan bool)
 	for {
 		select {
-		case userJoined := <-cvr.userConnect:
-			user, err := cvr.session.User(userJoined.userId)
+		case userJoined := <-cvr.voip.SpeakerConnect():
+			user, err := cvr.voip.User(userJoined.UserId)
 			if err != nil || user.Bot {
-				if user.Bot{
+				if err == nil {
 					zap.S().Debug(
 						"User was not added because bot",
-						zap.String("userid", userJoined.userId),
+						zap.String("userid", userJoined.UserId),
 						zap.String("operation", "User Joined"),
 						)
 				}
 				continue
 			}
 			silenceFrames := 0
-			if _, exists := cvr.channelConnectedUsers.bySSRC[userJoined.ssrc]; exists {
+			if _, exists := cvr.channelConnectedUsers.bySSRC[userJoined.SSRC]; exists {
 				continue
 			}
-			if unknownUserSilencePackets, exists := unknownUsersSilencePackets[userJoined.ssrc]; exists {
+			if unknownUserSilencePackets, exists := unknownUsersSilencePackets[userJoined.SSRC]; exists {
 				silenceFrames = unknownUserSilencePackets
 			}
-			if err := cvr.channelConnectedUsers.add(userJoined.userId, userJoined.ssrc, cvr.KeywordRecognitionNotify, silenceFrames); err != nil {
+			if err := cvr.channelConnectedUsers.add(userJoined.UserId, userJoined.SSRC, cvr.KeywordRecognitionNotify, silenceFrames, cvr.wakeWord(userJoined.UserId)); err != nil {
 				zap.S().Info(
 					"Failed to add user to connected users",
-					zap.String("userid", userJoined.userId),
+					zap.String("userid", userJoined.UserId),
 					zap.String("operation", "User Joined"),
 					zap.String("err", err.Error()),
 					)
 			}
 			zap.S().Info(
 				"User connected",
-				zap.String("userid", userJoined.userId),
+				zap.String("userid", userJoined.UserId),
 				zap.String("operation", "User Joined"),
 				)
-		case userIdLeft := <-cvr.userDisconnect:
+			if closes, pending := cvr.pendingPushToTalk[userJoined.UserId]; pending {
+				delete(cvr.pendingPushToTalk, userJoined.UserId)
+				//the rate limit was checked when they pushed but others may have started commands since
+				if window := time.Until(closes); window > 0 && len(cvr.commandSessions) < cvr.maxConcurrentCommands {
+					cvr.startPushToTalk(userJoined.UserId, userJoined.SSRC, window)
+				}
+			}
+		case userIdLeft := <-cvr.voip.SpeakerDisconnect():
+			if connectedUser, exists := cvr.channelConnectedUsers.byUserId[userIdLeft]; exists {
+				if session, exists := cvr.commandSessions[connectedUser.ssrc]; exists {
+					session.state.Fire(Cancelled)
+				}
+			}
 			cvr.channelConnectedUsers.remove(userIdLeft)
 			zap.S().Info(
 				"User disconnected",
@@ -133,7 +180,7 @@ func (cvr *ChannelVoiceRecognitionController) Start() {
 				zap.String("operation", "User Disconnect"),
 			)
 
-		case opusPacket := <-cvr.voiceConnection.OpusRecv:
+		case opusPacket := <-cvr.voip.OpusRecv():
 			zap.S().Debug("sorting voice packet start")
 			if _, exists := cvr.channelConnectedUsers.bySSRC[opusPacket.SSRC]; !exists {
 				//this is a hack to get around the fact that silence packets are sent before the user joined event triggers
@@ -147,8 +194,12 @@ func (cvr *ChannelVoiceRecognitionController) Start() {
 				continue
 			}
 
-			if cvr.userSpeakingCommand != opusPacket.SSRC {
-				cvr.channelConnectedUsers.bySSRC[opusPacket.SSRC].keyPhraseRecognition.VoiceInfoRecv <- voiceInfo
+			//key phrase recognition always hears the user so they can cancel at any point
+			if keyPhraseRecognition := cvr.channelConnectedUsers.bySSRC[opusPacket.SSRC].keyPhraseRecognition; keyPhraseRecognition != nil {
+				keyPhraseRecognition.VoiceInfoRecv <- voiceInfo
+			}
+			session, exists := cvr.commandSessions[opusPacket.SSRC]
+			if !exists || !session.listening() {
 				zap.S().Debug("sorting voice packet end key phrase recognition")
 				continue
 			}
@@ -156,52 +207,121 @@ func (cvr *ChannelVoiceRecognitionController) Start() {
 			//non blocking since receiving function might complete before cleanup
 			//added significant buffer to voiceInfoRecv so packets getting sent to fast aren't ignored
 			select{
-				case cvr.commandRecognition.VoiceInfoRecv <- voiceInfo:
+				case session.commandRecognition.VoiceInfoRecv <- voiceInfo:
+				default:
 			}
 			zap.S().Debug("sorting voice packet end command recognition end")
 
-		case command := <-cvr.commandNotify:
-			zap.S().Infof("user %s said command \"%s\"", cvr.channelConnectedUsers.bySSRC[cvr.userSpeakingCommand].userId, command)
-			pulseStop <- true
-			cvr.commandProcessed = commandProcessing(cvr.channelConnectedUsers.bySSRC[cvr.userSpeakingCommand].userId, command, cvr.voiceConnection)
+		case commandSpoken := <-cvr.commandNotify:
+			session, exists := cvr.commandSessions[commandSpoken.ssrc]
+			if !exists {
+				continue
+			}
+			zap.S().Infof("user %s said command \"%s\" with confidence %.2f", session.userId, commandSpoken.command, commandSpoken.confidence)
+			cvr.notifyPipelineEvent(PipelineEvent{
+				Type:       CommandTranscribed,
+				UserId:     session.userId,
+				Text:       commandSpoken.command,
+				Confidence: commandSpoken.confidence,
+			})
+			if isCancelPhrase(commandSpoken.command) {
+				cvr.cancelSession(session)
+				continue
+			}
+			if err := session.state.Fire(CommandHeard); err != nil {
+				zap.S().Info(err)
+				continue
+			}
+			cvr.processSessionCommand(session, commandSpoken.command)
+
+		case sessionEvent := <-cvr.sessionEventNotify:
+			//the session might have timed out and the user started a new one since
+			if cvr.commandSessions[sessionEvent.session.ssrc] != sessionEvent.session {
+				continue
+			}
+			if err := sessionEvent.session.state.Fire(sessionEvent.event); err != nil {
+				zap.S().Info(err)
+				continue
+			}
+			if sessionEvent.session.state.State() == FollowUp {
+				zap.S().Infof("listening for user %s to reply", sessionEvent.session.userId)
+				cvr.startListening(sessionEvent.session)
+			}
 
-		case <-cvr.commandProcessed:
-			zap.S().Infof("Completed listing of command and processing for user %s", cvr.channelConnectedUsers.bySSRC[cvr.userSpeakingCommand].userId)
-			cvr.commandRecognition = nil
-			cvr.userSpeakingCommand = 0
+		case sessionTimeout := <-cvr.sessionTimeoutNotify:
+			if cvr.commandSessions[sessionTimeout.session.ssrc] != sessionTimeout.session {
+				continue
+			}
+			if sessionTimeout.session.state.Expired(sessionTimeout.timeout) {
+				zap.S().Infof("command for user %s timed out while %s", sessionTimeout.session.userId, sessionTimeout.timeout.State)
+			}
 
 		case keywordNotify := <-cvr.KeywordRecognitionNotify:
 			if _, exists := cvr.channelConnectedUsers.bySSRC[keywordNotify.ssrc]; !exists {
 				continue
 			}
-			zap.S().Infof("user %s said keyword %s", cvr.channelConnectedUsers.bySSRC[keywordNotify.ssrc].userId, keywordNotify.keyPhrase)
-			if cvr.userSpeakingCommand != 0 {
-				zap.S().Infof("user %s can't use command recognition already in use by user %s", cvr.channelConnectedUsers.bySSRC[keywordNotify.ssrc].userId, cvr.channelConnectedUsers.bySSRC[cvr.userSpeakingCommand].userId)
+			userId := cvr.channelConnectedUsers.bySSRC[keywordNotify.ssrc].userId
+			session, exists := cvr.commandSessions[keywordNotify.ssrc]
+			//key phrase recognition keeps listening during commands so only cancelling matters then
+			if exists && !isCancelPhrase(keywordNotify.keyPhrase) {
+				zap.S().Debugf("user %s is already giving a command", userId)
 				continue
 			}
-			cvr.userSpeakingCommand = keywordNotify.ssrc
-			startupWav, err := ioutil.ReadFile("VoiceRecognition/Sounds/Listening.wav")
-			if err != nil {
-				zap.S().Info(err)
+			if !exists && isCancelPhrase(keywordNotify.keyPhrase) {
+				continue
+			}
+			zap.S().Infof("user %s said keyword %s", userId, keywordNotify.keyPhrase)
+			cvr.notifyPipelineEvent(PipelineEvent{
+				Type:   KeyPhraseDetected,
+				UserId: userId,
+				Text:   keywordNotify.keyPhrase,
+			})
+			if exists {
+				cvr.cancelSession(session)
+				continue
+			}
+			if len(cvr.commandSessions) >= cvr.maxConcurrentCommands {
+				zap.S().Infof("user %s can't use command recognition %d commands are already in progress", userId, len(cvr.commandSessions))
+				continue
+			}
+			if !cvr.allowSession(userId) {
+				//the cooldown is only read out once so saying the key phrase over and over doesn't use up text to speech instead
+				if !cvr.cooledDown[userId] {
+					cvr.cooledDown[userId] = true
+					go cvr.sayCooldown(cvr.config.Commands.RateLimits.Cooldown, cvr.sessionTimeouts[Responding])
+				}
+				continue
 			}
+			session = cvr.createSession(keywordNotify.ssrc, userId, cvr.sessionTimeouts)
+			session.state.Fire(KeyPhraseHeard)
+			cvr.startListening(session)
 
-			err = playWaveAudio(startupWav, cvr.voiceConnection)
-			if err != nil {
-				zap.S().Info(err)
+		case request := <-cvr.pushToTalkNotify:
+			window := pushToTalkWindow(cvr.config)
+			request.result <- pushToTalkResult{window: window, err: cvr.pushToTalk(request.userId, window)}
+
+		case config := <-cvr.configNotify:
+			//sessions already in progress keep the timeouts they started with
+			rebuild := config.SphinxChanged(cvr.config)
+			cvr.config = config
+			cvr.maxConcurrentCommands = config.DiscordChannel(cvr.guildId, cvr.voiceChannelId).MaxConcurrent
+			cvr.sessionTimeouts = sessionTimeoutsFromConfig(config)
+			if rebuild {
+				zap.S().Info("reloading key phrase recognition for the new sphinx config")
 			}
-			pulseBot(pulseStop, cvr.voiceConnection)
-			cvr.commandRecognition = createCommandRecognition(cvr.commandNotify)
+			cvr.channelConnectedUsers.reloadKeyPhraseRecognition(cvr.KeywordRecognitionNotify, cvr.wakeWord, rebuild)
 
 		case complete := <-cvr.close:
+			Config.Unsubscribe(cvr.configNotify)
 			for _, connectedUser := range cvr.channelConnectedUsers.byUserId {
-				close(connectedUser.keyPhraseRecognition.VoiceInfoRecv)
-
+				connectedUser.stopKeyPhraseRecognition()
 			}
-			if cvr.commandRecognition != nil {
-				cvr.commandRecognition.close <- true
+			for _, session := range cvr.commandSessions {
+				session.state.Fire(Cancelled)
 			}
-			cvr.voiceConnection.Close()
-			if err := cvr.session.Close(); err != nil {
+			close(cvr.stopped)
+			cvr.playback.Close()
+			if err := cvr.voip.Close(); err != nil {
 				zap.S().Warn(err)
 			}
 			complete <- true
@@ -210,61 +330,157 @@ func (cvr *ChannelVoiceRecognitionController) Start() {
 	}
 }
 
-func pulseBot(pulseStop <-chan bool, voiceConnection *discordgo.VoiceConnection) {
+func pulseBot(pulseStop <-chan bool, playback *PlaybackQueue) {
 	go func() {
-		realSilenceFrame := []byte{
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		ticker := time.NewTicker(1500 * time.Millisecond)
+		defer ticker.Stop()
+		playback.pulse()
 		for {
-			ticker := time.NewTicker(1500 * time.Millisecond)
-			voiceConnection.Speaking(true)
-			voiceConnection.OpusSend <- realSilenceFrame
-			voiceConnection.Speaking(false)
 			select {
 			case <-ticker.C:
-				voiceConnection.Speaking(true)
-				voiceConnection.OpusSend <- realSilenceFrame
-				voiceConnection.Speaking(false)
+				playback.pulse()
 			case <-pulseStop:
-				ticker.Stop()
 				return
 			}
 		}
 	}()
 }
 
-func (cvr *ChannelVoiceRecognitionController) Close() chan bool {
-	complete := make(chan bool)
-	cvr.close <- complete
-	return complete
+func (cvr *ChannelVoiceRecognitionController) anyListening() bool {
+	for _, session := range cvr.commandSessions {
+		if session.listening() {
+			return true
+		}
+	}
+	return false
+}
+
+//the pulse is shared by everyone giving a command so only stops once the last one has been heard
+func (cvr *ChannelVoiceRecognitionController) stopPulseIfNotListening() {
+	if cvr.pulsing && !cvr.anyListening() {
+		cvr.pulseStop <- true
+		cvr.pulsing = false
+	}
 }
 
-func disconnectHandler(session *discordgo.Session, userDisconnect chan<- string) {
-	session.AddHandler(func(session *discordgo.Session, state *discordgo.VoiceStateUpdate) {
-		if len(state.ChannelID) == 0 {
-			userDisconnect <- state.UserID
+func (cvr *ChannelVoiceRecognitionController) createSession(ssrc uint32, userId string, timeouts SessionTimeouts) *CommandSession {
+	session := &CommandSession{
+		ssrc:           ssrc,
+		userId:         userId,
+		guildId:        cvr.guildId,
+		voiceChannelId: cvr.voiceChannelId,
+		conversation:   createConversation(),
+	}
+	//roles are looked up while processing so a role change applies to the next command
+	session.roles = func() ([]string, error) {
+		user, err := cvr.voip.User(userId)
+		if err != nil {
+			return nil, err
+		}
+		return user.Roles, nil
+	}
+	session.ctx, session.cancel = context.WithCancel(context.Background())
+	session.state = createSessionStateMachine(timeouts, func(timeout SessionTimeout) {
+		select {
+		case cvr.sessionTimeoutNotify <- sessionTimeoutNotify{session: session, timeout: timeout}:
+		case <-cvr.stopped:
 		}
 	})
+	session.state.AddHook(func(transition SessionTransition) {
+		cvr.sessionTransitioned(session, transition)
+	})
+	cvr.commandSessions[ssrc] = session
+	return session
 }
 
-func connectHandler(connection *discordgo.VoiceConnection, userConnect chan<- userConnectInfo) {
-	connection.AddHandler(func(vc *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
-		userConnect <- userConnectInfo{
-			ssrc:   uint32(vs.SSRC),
-			userId: vs.UserID,
-		}
+func (cvr *ChannelVoiceRecognitionController) sessionTransitioned(session *CommandSession, transition SessionTransition) {
+	zap.S().Debugf("command session for user %s went from %s to %s on %s", session.userId, transition.From, transition.To, transition.Event)
+	cvr.notifyPipelineEvent(PipelineEvent{
+		Type:       SessionStateChanged,
+		UserId:     session.userId,
+		Text:       string(transition.To),
+		Transition: &transition,
 	})
+	if transition.To != Listening {
+		session.stopListening()
+		cvr.stopPulseIfNotListening()
+	}
+	if transition.To == Idle {
+		session.cancel()
+		if cvr.commandSessions[session.ssrc] == session {
+			delete(cvr.commandSessions, session.ssrc)
+		}
+	}
+}
+
+//cancelSession stops listening or cuts the response off part way through
+func (cvr *ChannelVoiceRecognitionController) cancelSession(session *CommandSession) {
+	zap.S().Infof("user %s cancelled their command while %s", session.userId, session.state.State())
+	if err := session.state.Fire(Cancelled); err != nil {
+		zap.S().Info(err)
+	}
+}
+
+//plays the listening sound and opens command recognition for the session
+func (cvr *ChannelVoiceRecognitionController) startListening(session *CommandSession) {
+	commandRecognition, err := newCommandRecognition(session.ssrc, cvr.commandNotify, cvr.speechToText, session.state.Timeout(Listening))
+	if err != nil {
+		zap.S().Warnf("Failed to start command recognition: %s", err)
+		session.state.Fire(Failed)
+		return
+	}
+	startupWav, err := ioutil.ReadFile(soundsPath + "Listening.wav")
+	if err != nil {
+		zap.S().Info(err)
+	}
+	//not waited on so voice keeps flowing to everyone while it plays
+	cvr.playback.Play(startupWav)
+	session.commandRecognition = commandRecognition
+	if !cvr.pulsing {
+		pulseBot(cvr.pulseStop, cvr.playback)
+		cvr.pulsing = true
+	}
+	session.state.Fire(ListeningStarted)
+}
+
+//processing happens in the background and reports back how the session should move on
+func (cvr *ChannelVoiceRecognitionController) processSessionCommand(session *CommandSession, command string) {
+	sessionEvents := processCommand(session, command, cvr.playback, cvr.textToSpeech, cvr.pipelineEventNotify)
+	go func() {
+		for event := range sessionEvents {
+			select {
+			case cvr.sessionEventNotify <- sessionEventNotify{session: session, event: event}:
+			case <-cvr.stopped:
+				return
+			}
+		}
+	}()
+}
+
+//Say reads text out in the voice channel. it doesn't touch anything the controller loop owns so can be
+//called from anywhere
+func (cvr *ChannelVoiceRecognitionController) Say(ctx context.Context, text string) error {
+	wave, err := cvr.textToSpeech.Synthesize(ctx, text)
+	if err != nil {
+		return err
+	}
+	return <-cvr.playback.PlayContext(ctx, wave)
+}
+
+//events say which channel they came from since one listener can follow several controllers
+func (cvr *ChannelVoiceRecognitionController) notifyPipelineEvent(event PipelineEvent) {
+	event.GuildId = cvr.guildId
+	event.VoiceChannelId = cvr.voiceChannelId
+	notifyPipelineEvent(cvr.pipelineEventNotify, event)
+}
+
+func (cvr *ChannelVoiceRecognitionController) Close() chan bool {
+	complete := make(chan bool)
+	cvr.close <- complete
+	return complete
 }
 
-func (cvr *ChannelVoiceRecognitionController) buildVoiceInfo(packet *discordgo.Packet) *VoiceInfo {
+func (cvr *ChannelVoiceRecognitionController) buildVoiceInfo(packet *VoicePacket) *VoiceInfo {
 	channelConnectedUser := cvr.channelConnectedUsers.bySSRC[packet.SSRC]
 	if !bytes.Equal(packet.Opus, opusSilence) {
 		return &VoiceInfo{packet: packet, speaking: true}
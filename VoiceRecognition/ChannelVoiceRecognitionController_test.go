@@ -0,0 +1,658 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+)
+
+type processedCommand struct {
+	userId         string
+	guildId        string
+	voiceChannelId string
+	command        string
+	conversationId string
+	turns          int
+}
+
+//tone builds a mono 16khz wave so the fake has something to encode. what it sounds like doesn't
+//matter since the recognisers below are scripted
+func toneWave(frequency float64, duration time.Duration) []byte {
+	const sampleRate = 16000
+	samples := int(duration.Seconds() * sampleRate)
+	var wave bytes.Buffer
+	wave.WriteString("RIFF")
+	binary.Write(&wave, binary.LittleEndian, uint32(36+samples*2))
+	wave.WriteString("WAVEfmt ")
+	//pcm, mono, sample rate, byte rate, block align, bits per sample
+	for _, field := range []interface{}{uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16)} {
+		binary.Write(&wave, binary.LittleEndian, field)
+	}
+	wave.WriteString("data")
+	binary.Write(&wave, binary.LittleEndian, uint32(samples*2))
+	for i := 0; i < samples; i++ {
+		sample := int16(math.Sin(2*math.Pi*frequency*float64(i)/sampleRate) * 8000)
+		binary.Write(&wave, binary.LittleEndian, sample)
+	}
+	return wave.Bytes()
+}
+
+//notifies the next key phrase every time the user stops speaking. the last one is repeated
+func scriptedKeyPhraseRecognition(created chan<- bool, keyPhrases ...string) func(chan KeywordSpokenNotify) (*KeyPhraseRecognition, error) {
+	return func(keywordSpokenNotify chan KeywordSpokenNotify) (*KeyPhraseRecognition, error) {
+		kr := &KeyPhraseRecognition{
+			VoiceInfoRecv:       make(chan *VoiceInfo, 100),
+			keywordSpokenNotify: keywordSpokenNotify,
+		}
+		go func() {
+			heardSpeech := false
+			for voiceInfo := range kr.VoiceInfoRecv {
+				if voiceInfo.speaking {
+					heardSpeech = true
+					continue
+				}
+				if heardSpeech {
+					heardSpeech = false
+					kr.keywordSpokenNotify <- KeywordSpokenNotify{ssrc: voiceInfo.packet.SSRC, keyPhrase: keyPhrases[0]}
+					if len(keyPhrases) > 1 {
+						keyPhrases = keyPhrases[1:]
+					}
+				}
+			}
+		}()
+		if created != nil {
+			created <- true
+		}
+		return kr, nil
+	}
+}
+
+//transcribes the first utterance as the given command once it is followed by silence
+type scriptedSpeechToText struct {
+	transcript string
+}
+
+type scriptedSpeechToTextStream struct {
+	transcript   string
+	transcripts  chan Transcript
+	heardSpeech  bool
+	silentFrames int
+	finished     bool
+}
+
+func (s *scriptedSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	return &scriptedSpeechToTextStream{transcript: s.transcript, transcripts: make(chan Transcript, 10)}, nil
+}
+
+func (ss *scriptedSpeechToTextStream) SendPCM(pcm []int16) error {
+	if ss.finished {
+		return nil
+	}
+	silent := true
+	for _, sample := range pcm {
+		if sample != 0 {
+			silent = false
+			break
+		}
+	}
+	if !silent {
+		ss.heardSpeech = true
+		ss.silentFrames = 0
+		return nil
+	}
+	ss.silentFrames++
+	if ss.heardSpeech && ss.silentFrames == 10 {
+		ss.transcripts <- Transcript{Text: ss.transcript, Final: true}
+		ss.finish()
+	}
+	return nil
+}
+
+func (ss *scriptedSpeechToTextStream) Transcripts() <-chan Transcript {
+	return ss.transcripts
+}
+
+func (ss *scriptedSpeechToTextStream) Err() error {
+	return nil
+}
+
+func (ss *scriptedSpeechToTextStream) Close() error {
+	ss.finish()
+	return nil
+}
+
+func (ss *scriptedSpeechToTextStream) finish() {
+	if !ss.finished {
+		ss.finished = true
+		close(ss.transcripts)
+	}
+}
+
+//plays the response wave instead of calling rasa, the remote bot and text to speech. the first
+//followUps turns of a conversation expect a reply
+func scriptedCommandProcessing(response []byte, processed chan<- processedCommand, followUps int) func(*CommandSession, string, *PlaybackQueue, TextToSpeech, chan<- PipelineEvent) <-chan SessionEvent {
+	return func(session *CommandSession, command string, playback *PlaybackQueue, textToSpeech TextToSpeech, pipelineEventNotify chan<- PipelineEvent) <-chan SessionEvent {
+		sessionEvents := make(chan SessionEvent, 2)
+		ctx := session.ctx
+		conversation := session.conversation
+		go func() {
+			defer close(sessionEvents)
+			processed <- processedCommand{
+				userId:         session.userId,
+				guildId:        session.guildId,
+				voiceChannelId: session.voiceChannelId,
+				command:        command,
+				conversationId: conversation.Id,
+				turns:          len(conversation.Turns),
+			}
+			conversation.addTurn(ConversationTurn{Command: command})
+			sessionEvents <- ResponseReady
+			if err := <-playback.PlayContext(ctx, response); err != nil {
+				sessionEvents <- Failed
+				return
+			}
+			if len(conversation.Turns) <= followUps {
+				sessionEvents <- ReplyExpected
+			} else {
+				sessionEvents <- ResponseFinished
+			}
+		}()
+		return sessionEvents
+	}
+}
+
+func setupScriptedPipeline(t *testing.T, keyPhrase string, response []byte) (chan bool, chan processedCommand) {
+	created := make(chan bool, 10)
+	processed := make(chan processedCommand, 10)
+	soundsPath = "Sounds/"
+	newKeyPhraseRecognition = scriptedKeyPhraseRecognition(created, keyPhrase)
+	processCommand = scriptedCommandProcessing(response, processed, 0)
+	t.Cleanup(func() {
+		soundsPath = "VoiceRecognition/Sounds/"
+		newKeyPhraseRecognition = createKeyPhraseRecognition
+		processCommand = commandProcessing
+	})
+	return created, processed
+}
+
+func clipMatching(t *testing.T, wave []byte) func([][]byte) bool {
+	expected, err := waveToOpusFrames(wave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(clip [][]byte) bool {
+		if len(clip) != len(expected) {
+			return false
+		}
+		for i := range clip {
+			if !bytes.Equal(clip[i], expected[i]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func readSound(t *testing.T, name string) []byte {
+	wave, err := ioutil.ReadFile("Sounds/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wave
+}
+
+func testConfig(maxConcurrentCommands int) Config.Config {
+	var config Config.Config
+	config.Commands.MaxConcurrent = maxConcurrentCommands
+	return config
+}
+
+func closeController(t *testing.T, cvr ChannelVoiceRecognitionController) {
+	select {
+	case <-cvr.Close():
+	case <-time.After(5 * time.Second):
+		t.Fatal("controller did not close")
+	}
+}
+
+func TestStartupSoundPlayed(t *testing.T) {
+	setupScriptedPipeline(t, "hey lydia", nil)
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{}, nil, testConfig(1), "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	if _, err := voip.WaitForClip(clipMatching(t, readSound(t, "startup.wav")), 5*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeywordCommandResponse(t *testing.T) {
+	response := toneWave(660, 500*time.Millisecond)
+	_, processed := setupScriptedPipeline(t, "hey lydia", response)
+	voip := CreateFakeVOIPService()
+	pipelineEvents := make(chan PipelineEvent, 10)
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, testConfig(1), "guild", "voice", pipelineEvents)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	if err := voip.SpeakWave(1, toneWave(440, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := voip.WaitForClip(clipMatching(t, readSound(t, "Listening.wav")), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := voip.SpeakWave(1, toneWave(440, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case command := <-processed:
+		if command.userId != "user1" || command.command != "play air horn" || command.guildId != "guild" || command.voiceChannelId != "voice" {
+			t.Errorf("unexpected command %+v", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+	if _, err := voip.WaitForClip(clipMatching(t, response), 5*time.Second); err != nil {
+		t.Error(err)
+	}
+	for _, expected := range []PipelineEvent{
+		{Type: KeyPhraseDetected, UserId: "user1", Text: "hey lydia"},
+		{Type: SessionStateChanged, UserId: "user1", Text: string(WakeDetected)},
+		{Type: SessionStateChanged, UserId: "user1", Text: string(Listening)},
+		{Type: CommandTranscribed, UserId: "user1", Text: "play air horn"},
+		{Type: SessionStateChanged, UserId: "user1", Text: string(Understanding)},
+		{Type: SessionStateChanged, UserId: "user1", Text: string(Responding)},
+		{Type: SessionStateChanged, UserId: "user1", Text: string(Idle)},
+	} {
+		select {
+		case event := <-pipelineEvents:
+			if event.Type != expected.Type || event.UserId != expected.UserId || event.Text != expected.Text {
+				t.Errorf("expected event %+v got %+v", expected, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected event %+v", expected)
+		}
+	}
+}
+
+func TestBotSpeakerIgnored(t *testing.T) {
+	created, _ := setupScriptedPipeline(t, "hey lydia", nil)
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{}, nil, testConfig(1), "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "bot", Username: "bot", Bot: true})
+	voip.AddSpeaker(2, VOIPUser{Id: "user2", Username: "user2"})
+	//the bot was announced first so if it had been added its recognition would already exist
+	select {
+	case <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("key phrase recognition was not created for the user")
+	}
+	select {
+	case <-created:
+		t.Error("key phrase recognition was created for the bot")
+	default:
+	}
+}
+
+func waitForClips(t *testing.T, voip *FakeVOIPService, matches func([][]byte) bool, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if countClips(voip, matches) >= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d matching clips got %d", count, countClips(voip, matches))
+}
+
+func countClips(voip *FakeVOIPService, matches func([][]byte) bool) int {
+	count := 0
+	for _, clip := range voip.Clips() {
+		if matches(clip) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	response := toneWave(660, 500*time.Millisecond)
+	_, processed := setupScriptedPipeline(t, "hey lydia", response)
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, testConfig(2), "guild", "voice", nil)
+	defer closeController(t, cvr)
+	listening := clipMatching(t, readSound(t, "Listening.wav"))
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.AddSpeaker(2, VOIPUser{Id: "user2", Username: "user2"})
+	//both users are listened to before either has given their command
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, listening, 1)
+	voip.SpeakWave(2, toneWave(440, time.Second))
+	waitForClips(t, voip, listening, 2)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	voip.SpeakWave(2, toneWave(440, time.Second))
+
+	users := make(map[string]bool)
+	for len(users) < 2 {
+		select {
+		case command := <-processed:
+			users[command.userId] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only commands from %v were processed", users)
+		}
+	}
+	//each response is its own clip since the playback queue stops them overlapping
+	waitForClips(t, voip, clipMatching(t, response), 2)
+}
+
+func TestConcurrentCommandLimit(t *testing.T) {
+	_, processed := setupScriptedPipeline(t, "hey lydia", nil)
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, testConfig(1), "guild", "voice", nil)
+	defer closeController(t, cvr)
+	listening := clipMatching(t, readSound(t, "Listening.wav"))
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.AddSpeaker(2, VOIPUser{Id: "user2", Username: "user2"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, listening, 1)
+	voip.SpeakWave(2, toneWave(440, time.Second))
+	time.Sleep(500 * time.Millisecond)
+	if count := countClips(voip, listening); count != 1 {
+		t.Errorf("expected the second user to be turned away got %d listening clips", count)
+	}
+
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case command := <-processed:
+		if command.userId != "user1" {
+			t.Errorf("unexpected command %+v", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+}
+
+func TestFollowUpWithoutKeyPhrase(t *testing.T) {
+	response := toneWave(660, 500*time.Millisecond)
+	_, processed := setupScriptedPipeline(t, "hey lydia", response)
+	processCommand = scriptedCommandProcessing(response, processed, 1)
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "fog horn"}, nil, testConfig(1), "guild", "voice", nil)
+	defer closeController(t, cvr)
+	listening := clipMatching(t, readSound(t, "Listening.wav"))
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, listening, 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	var first processedCommand
+	select {
+	case first = <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+	//the bot starts listening again after the response without the key phrase
+	waitForClips(t, voip, clipMatching(t, response), 1)
+	waitForClips(t, voip, listening, 2)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case reply := <-processed:
+		if reply.conversationId != first.conversationId || reply.turns != 1 {
+			t.Errorf("expected the reply to continue conversation %s with 1 turn got %+v", first.conversationId, reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply was never processed")
+	}
+	waitForClips(t, voip, clipMatching(t, response), 2)
+	//the conversation is over so the next command needs the key phrase again
+	time.Sleep(200 * time.Millisecond)
+	if count := countClips(voip, listening); count != 2 {
+		t.Errorf("expected the conversation to end after the reply got %d listening clips", count)
+	}
+}
+
+//drains pipeline events until the session goes back to idle because of event
+func waitForSessionEnd(t *testing.T, pipelineEvents <-chan PipelineEvent, event SessionEvent) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pipelineEvent := <-pipelineEvents:
+			if pipelineEvent.Type != SessionStateChanged || pipelineEvent.Transition.To != Idle {
+				continue
+			}
+			if pipelineEvent.Transition.Event != event {
+				t.Fatalf("expected the session to end on %s got %s", event, pipelineEvent.Transition.Event)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("session never ended on %s", event)
+		}
+	}
+}
+
+func TestCancelWhileListening(t *testing.T) {
+	_, processed := setupScriptedPipeline(t, "hey lydia", nil)
+	voip := CreateFakeVOIPService()
+	pipelineEvents := make(chan PipelineEvent, 100)
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "Cancel."}, nil, testConfig(1), "guild", "voice", pipelineEvents)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, clipMatching(t, readSound(t, "Listening.wav")), 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForSessionEnd(t, pipelineEvents, Cancelled)
+	select {
+	case command := <-processed:
+		t.Errorf("cancel was processed as a command %+v", command)
+	default:
+	}
+}
+
+func TestBargeInStopsResponse(t *testing.T) {
+	response := toneWave(660, 3*time.Second)
+	_, processed := setupScriptedPipeline(t, "hey lydia", response)
+	//the command itself is heard as the key phrase again and ignored, speaking over the response cancels it
+	newKeyPhraseRecognition = scriptedKeyPhraseRecognition(nil, "hey lydia", "hey lydia", "lydia stop")
+	voip := CreateFakeVOIPService()
+	voip.PlaybackInterval = 10 * time.Millisecond
+	pipelineEvents := make(chan PipelineEvent, 100)
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play fog horn"}, nil, testConfig(1), "guild", "voice", pipelineEvents)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, clipMatching(t, readSound(t, "Listening.wav")), 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+	//long enough for the response to be encoded and start playing
+	time.Sleep(500 * time.Millisecond)
+	voip.SpeakWave(1, toneWave(440, 200*time.Millisecond))
+	waitForSessionEnd(t, pipelineEvents, Cancelled)
+
+	frames, err := waveToOpusFrames(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip, err := voip.WaitForClip(func(clip [][]byte) bool {
+		return len(clip) > 0 && bytes.Equal(clip[0], frames[0])
+	}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clip) >= len(frames) {
+		t.Errorf("expected the response to be cut off got %d of %d frames", len(clip), len(frames))
+	}
+}
+
+func TestMultipleChannels(t *testing.T) {
+	_, processed := setupScriptedPipeline(t, "hey lydia", nil)
+	speechToText := &scriptedSpeechToText{transcript: "play air horn"}
+	voip1 := CreateFakeVOIPService()
+	voip2 := CreateFakeVOIPService()
+	cvr1 := CreateChannelVoiceRecognitionController(voip1, speechToText, nil, testConfig(1), "guild1", "voice1", nil)
+	defer closeController(t, cvr1)
+	cvr2 := CreateChannelVoiceRecognitionController(voip2, speechToText, nil, testConfig(1), "guild2", "voice2", nil)
+	defer closeController(t, cvr2)
+
+	//the same ssrc in both channels are different users
+	voip1.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip2.AddSpeaker(1, VOIPUser{Id: "user2", Username: "user2"})
+	for _, voip := range []*FakeVOIPService{voip1, voip2} {
+		voip.SpeakWave(1, toneWave(440, time.Second))
+		waitForClips(t, voip, clipMatching(t, readSound(t, "Listening.wav")), 1)
+		voip.SpeakWave(1, toneWave(440, time.Second))
+	}
+	channels := map[string]string{}
+	for len(channels) < 2 {
+		select {
+		case command := <-processed:
+			channels[command.userId] = command.guildId + "/" + command.voiceChannelId
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only commands from %v were processed", channels)
+		}
+	}
+	if channels["user1"] != "guild1/voice1" || channels["user2"] != "guild2/voice2" {
+		t.Errorf("expected commands to carry their own channel got %v", channels)
+	}
+}
+
+func TestPushToTalk(t *testing.T) {
+	created, processed := setupScriptedPipeline(t, "hey lydia", nil)
+	voip := CreateFakeVOIPService()
+	config := testConfig(1)
+	config.Commands.Activation.Users = map[string]string{"user1": Config.PushToTalk}
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, config, "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	//discord doesn't say whose voice stream is whose until they talk so pushing first waits for them
+	window, err := cvr.PushToTalk("user1")
+	if err != nil || window != defaultPushToTalkWindow {
+		t.Fatalf("expected to listen for the default window got %s %v", window, err)
+	}
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	waitForClips(t, voip, clipMatching(t, readSound(t, "Listening.wav")), 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case command := <-processed:
+		if command.userId != "user1" || command.command != "play air horn" {
+			t.Errorf("unexpected command %+v", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+	select {
+	case <-created:
+		t.Error("key phrase recognition was created for a user that pushes to talk")
+	default:
+	}
+}
+
+func TestReloadKeyPhraseRecognition(t *testing.T) {
+	created, _ := setupScriptedPipeline(t, "hey lydia", nil)
+	keywordSpokenNotify := make(chan KeywordSpokenNotify)
+	users := createVoiceChannelUsers()
+	wakeWord := map[string]bool{"user1": true}
+	for ssrc, userId := range []string{"user1", "user2"} {
+		if err := users.add(userId, uint32(ssrc), keywordSpokenNotify, 0, wakeWord[userId]); err != nil {
+			t.Fatal(err)
+		}
+		defer users.remove(userId)
+	}
+	<-created
+	countCreated := func() int {
+		count := 0
+		for {
+			select {
+			case <-created:
+				count++
+			default:
+				return count
+			}
+		}
+	}
+
+	//a config that doesn't change sphinx keeps the decoders users already have
+	recognition := users.byUserId["user1"].keyPhraseRecognition
+	wakeWord["user2"] = true
+	users.reloadKeyPhraseRecognition(keywordSpokenNotify, func(userId string) bool { return wakeWord[userId] }, false)
+	if count := countCreated(); count != 1 || users.byUserId["user1"].keyPhraseRecognition != recognition || users.byUserId["user2"].keyPhraseRecognition == nil {
+		t.Errorf("expected only the user now using the wake word to get key phrase recognition got %d created", count)
+	}
+	users.reloadKeyPhraseRecognition(keywordSpokenNotify, func(userId string) bool { return wakeWord[userId] }, true)
+	if count := countCreated(); count != 2 {
+		t.Errorf("expected everyone to be rebuilt when sphinx changed got %d created", count)
+	}
+}
+
+//records how long each command recognition is told to listen for
+func recordListenFor(t *testing.T) chan time.Duration {
+	listenFor := make(chan time.Duration, 10)
+	newCommandRecognition = func(ssrc uint32, commandNotify chan<- CommandSpokenNotify, speechToText SpeechToText, timeout time.Duration) (*CommandRecognition, error) {
+		listenFor <- timeout
+		return createCommandRecognition(ssrc, commandNotify, speechToText, timeout)
+	}
+	t.Cleanup(func() {
+		newCommandRecognition = createCommandRecognition
+	})
+	return listenFor
+}
+
+func TestListeningTimeoutReachesRecognition(t *testing.T) {
+	setupScriptedPipeline(t, "hey lydia", nil)
+	listenFor := recordListenFor(t)
+	voip := CreateFakeVOIPService()
+	config := testConfig(1)
+	config.Commands.Timeouts.Listening = 30 * time.Second
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, config, "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case timeout := <-listenFor:
+		if timeout != 30*time.Second {
+			t.Errorf("expected recognition to listen for the 30s listening timeout got %s", timeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command recognition was never started")
+	}
+}
+
+func TestPushToTalkWindowReachesRecognition(t *testing.T) {
+	setupScriptedPipeline(t, "hey lydia", nil)
+	listenFor := recordListenFor(t)
+	voip := CreateFakeVOIPService()
+	config := testConfig(1)
+	config.Commands.Activation.Users = map[string]string{"user1": Config.PushToTalk}
+	config.Commands.Activation.Window = 40 * time.Second
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, config, "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	if _, err := cvr.PushToTalk("user1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case timeout := <-listenFor:
+		if timeout != 40*time.Second {
+			t.Errorf("expected recognition to listen for the 40s window got %s", timeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command recognition was never started")
+	}
+}
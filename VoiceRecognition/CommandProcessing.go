@@ -4,14 +4,11 @@ import (
 	"DiscordVoiceRecognition/Config"
 	"DiscordVoiceRecognition/RasaNLU"
 	"bytes"
-	texttospeech "cloud.google.com/go/texttospeech/apiv1"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/bwmarrin/discordgo"
 	"go.uber.org/zap"
-	texttospeechpb "google.golang.org/genproto/googleapis/cloud/texttospeech/v1"
 	"io/ioutil"
 	"layeh.com/gopus"
 	"net/http"
@@ -24,172 +21,78 @@ type UserCommand struct {
 	VoiceChannelId string            `json:"voicechannelid"`
 	Intent         RasaNLU.Intent    `json:"intent"`
 	Entities       map[string]string `json:"entities"`
+	ConversationId string            `json:"conversationid"`
+	//Turns are the earlier commands in the conversation, oldest first
+	Turns []ConversationTurn `json:"turns"`
 }
 
 type RemoteBotResponse struct {
 	Text       string `json:"text"`
 	Understood bool   `json:"understood"`
 	Callback   string `json:"callback"`
+	//ExpectReply listens for the users reply straight away without needing the key phrase again
+	ExpectReply bool `json:"expect_reply"`
 }
 
-func commandProcessing(userId string, command string, voice *discordgo.VoiceConnection) chan bool {
-	commandProcessed := make(chan bool)
+//the returned channel gets ResponseReady when the response is about to be read out then
+//ResponseFinished, ReplyExpected or Failed. it is closed once processing is done. cancelling the
+//sessions ctx stops processing without sending anything else. only the sessions fixed details and
+//conversation are used since the controller owns the rest
+func commandProcessing(session *CommandSession, command string, playback *PlaybackQueue, textToSpeech TextToSpeech, pipelineEventNotify chan<- PipelineEvent) <-chan SessionEvent {
+	sessionEvents := make(chan SessionEvent, 2)
+	ctx := session.ctx
+	userId := session.userId
+	notify := func(event PipelineEvent) {
+		//the session has moved on so the mirror would take anything late as part of the next one
+		if ctx.Err() != nil {
+			return
+		}
+		event.GuildId = session.guildId
+		event.VoiceChannelId = session.voiceChannelId
+		notifyPipelineEvent(pipelineEventNotify, event)
+	}
 	go func() {
-		config := Config.LoadConfig()
-		response := "sorry i didn't understand"
-		//rasa
-		parserResponse, err := RasaNLU.Parse(command, config.Rasa.Project)
-		if err != nil {
+		defer close(sessionEvents)
+		failed := func(err error) {
+			if ctx.Err() != nil {
+				zap.S().Infof("Command for user %s was cancelled", userId)
+				return
+			}
 			zap.S().Warn(err)
-			commandProcessed <- true
-			return
+			notify(PipelineEvent{Type: CommandFailed, UserId: userId, Err: err})
+			sessionEvents <- Failed
 		}
-		userCommand := newUserCommand(userId, parserResponse)
-		//remote bot
-		remoteBotResponse, err := sendUserCommandToRemoteBot(userCommand)
+		remoteBotResponse, response, err := understandCommand(ctx, session, command, Config.LoadConfig(), notify)
 		if err != nil {
-			zap.S().Warn(err)
-			commandProcessed <- true
+			failed(err)
 			return
 		}
-		if remoteBotResponse.Text != "" || remoteBotResponse.Understood {
-			zap.S().Info("Command understood by remote bot")
-			response = remoteBotResponse.Text
-		}
 		//response
-		responseWave, err := textToSpeech(response)
+		responseWave, err := textToSpeech.Synthesize(ctx, response)
 		if err != nil {
-			zap.S().Warn(err)
-			commandProcessed <- true
+			failed(err)
 			return
 		}
+		sessionEvents <- ResponseReady
 		zap.S().Info("Reading out response")
-		if err := playWaveAudio(responseWave, voice); err != nil {
-			zap.S().Warn(err)
-			commandProcessed <- true
+		if err := <-playback.PlayContext(ctx, responseWave); err != nil {
+			failed(err)
 			return
 		}
 		zap.S().Info("Finished reading response")
-		//callback remote bot
-		if remoteBotResponse.Callback != "" {
-			zap.S().Infof("callback to %s", remoteBotResponse.Callback)
-			client := http.Client{
-				Timeout: time.Duration(5 * time.Second),
-			}
-			client.Get(remoteBotResponse.Callback)
-			zap.S().Infof("finished callback to %s", remoteBotResponse.Callback)
+		callbackRemoteBot(remoteBotResponse)
+		notify(PipelineEvent{Type: CommandCompleted, UserId: userId})
+		if remoteBotResponse.ExpectReply {
+			zap.S().Info("Remote bot expects a reply")
+			sessionEvents <- ReplyExpected
+		} else {
+			sessionEvents <- ResponseFinished
 		}
-		commandProcessed <- true
 		zap.S().Info("Finished command processing")
-		return
 	}()
-	return commandProcessed
-}
-
-func textToSpeech(text string) ([]byte, error) {
-	ctx := context.Background()
-
-	client, err := texttospeech.NewClient(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	req := texttospeechpb.SynthesizeSpeechRequest{
-		Input: &texttospeechpb.SynthesisInput{
-			InputSource: &texttospeechpb.SynthesisInput_Text{Text: text},
-		},
-
-		Voice: &texttospeechpb.VoiceSelectionParams{
-			LanguageCode: "en-GB",
-			Name:         "en-GB-Wavenet-A",
-			SsmlGender:   texttospeechpb.SsmlVoiceGender_FEMALE,
-		},
-		AudioConfig: &texttospeechpb.AudioConfig{
-			AudioEncoding:   texttospeechpb.AudioEncoding_LINEAR16,
-			SampleRateHertz: 48000,
-		},
-	}
-
-	resp, err := client.SynthesizeSpeech(ctx, &req)
-	if err != nil {
-		return nil, err
-	}
-	return resp.AudioContent, nil
+	return sessionEvents
 }
 
-/*
-func playWaveAudio(wave []byte, voice *discordgo.VoiceConnection) error {
-	waveNoHeader := wave[44:]
-	pcmMono, err := byteSliceToInt16Slice(waveNoHeader)
-	if err != nil {
-		return err
-	}
-	pcmStereo := convertMonoToStero(pcmMono)
-	pcmFrames := pcmSliceToPCMFrameSlice(pcmStereo)
-	opusEncoder, err := opus.NewEncoder(discordSampleRate, 2, opus.AppVoIP)
-	if err != nil {
-		return err
-	}
-	//discord default bitrate
-	opusEncoder.SetBitrate(64 * 1000)
-	voice.Speaking(true)
-	for i := 0; i < len(pcmFrames); i++ {
-		opusFrame, err := encodePCMFrameToOpusBytes(pcmFrames[i], opusEncoder)
-		if err != nil {
-			log.Printf("failed to encode opus frame: %s", err)
-			continue
-		}
-		voice.OpusSend <- opusFrame
-	}
-	voice.Speaking(false)
-	return nil
-}
-*/
-
-func playWaveAudio(wave []byte, voice *discordgo.VoiceConnection) error {
-	waveNoHeader := wave[44:]
-	pcmMono, err := byteSliceToInt16Slice(waveNoHeader)
-	if err != nil {
-		return err
-	}
-	pcmStereo := convertMonoToStero(pcmMono)
-	pcmFrames := pcmSliceToPCMFrameSlice(pcmStereo)
-	opusEncoder, err := gopus.NewEncoder(48000, 2, gopus.Audio)
-	if err != nil {
-		return err
-	}
-	//discord default bitrate
-	voice.Speaking(true)
-	for i := 0; i < len(pcmFrames); i++ {
-		opusFrame, err := encodePCMFrameToOpusBytes(pcmFrames[i], opusEncoder)
-		if err != nil {
-			zap.S().Warn("failed to encode opus frame: %s", err)
-			continue
-		}
-		voice.OpusSend <- opusFrame
-	}
-	voice.Speaking(false)
-	return nil
-}
-
-/*
-func encodePCMFrameToOpusBytes(pcm []int16, opusEncoder *opus.Encoder) ([]byte, error) {
-	frameSize := len(pcm)
-	frameSizeMs := float32(frameSize) / 2 * 1000 / discordSampleRate
-	switch frameSizeMs {
-	case 2.5, 5, 10, 20, 40, 60:
-		// Good.
-	default:
-		return nil, fmt.Errorf("illegal frame size: %d bytes (%f ms)", frameSize, frameSizeMs)
-	}
-	data := make([]byte, 1000)
-	n, err := opusEncoder.Encode(pcm, data)
-	if err != nil {
-		return nil, err
-	}
-	return data[:n], nil
-}
-*/
 func encodePCMFrameToOpusBytes(pcm []int16, opusEncoder *gopus.Encoder) ([]byte, error) {
 	frameSize := len(pcm)
 	frameSizeMs := float32(frameSize) / 2 * 1000 / discordSampleRate
@@ -206,8 +109,7 @@ func encodePCMFrameToOpusBytes(pcm []int16, opusEncoder *gopus.Encoder) ([]byte,
 	return opusData, nil
 }
 
-func sendUserCommandToRemoteBot(userCommand *UserCommand) (*RemoteBotResponse, error) {
-	config := Config.LoadConfig()
+func sendUserCommandToRemoteBot(ctx context.Context, address string, userCommand *UserCommand) (*RemoteBotResponse, error) {
 	userCommandJson, err := json.Marshal(userCommand)
 	if err != nil {
 		return nil, err
@@ -217,9 +119,14 @@ func sendUserCommandToRemoteBot(userCommand *UserCommand) (*RemoteBotResponse, e
 	client := http.Client{
 		Timeout: timeout,
 	}
-	resp, err := client.Post(config.RemoteBot.Address, "application/json", requestBody)
+	request, err := http.NewRequest(http.MethodPost, address, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(request.WithContext(ctx))
 	if resp == nil {
-		return nil, errors.New("remote bot failed to respond")
+		return nil, fmt.Errorf("remote bot failed to respond: %s", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
@@ -234,13 +141,80 @@ func sendUserCommandToRemoteBot(userCommand *UserCommand) (*RemoteBotResponse, e
 	return remoteBotResponse, nil
 }
 
-func newUserCommand(userid string, parserResponse *RasaNLU.ParserResponse) *UserCommand {
-	config := Config.LoadConfig()
-	userCommand := UserCommand{UserId: userid, GuildId: config.Discord.Guild, VoiceChannelId: config.Discord.VoiceChannel, Intent: parserResponse.Intent}
+//understandCommand works out what the command meant with rasa then asks for a missing entity or sends it to
+//the remote bot. the returned text is what to answer with. spoken and typed commands both go through here
+func understandCommand(ctx context.Context, session *CommandSession, command string, config Config.Config, notify func(PipelineEvent)) (*RemoteBotResponse, string, error) {
+	userId := session.userId
+	conversation := session.conversation
+	response := "sorry i didn't understand"
+	//rasa
+	parserResponse, err := RasaNLU.Parse(command, config.Rasa.Project)
+	if err != nil {
+		return nil, "", err
+	}
+	notify(PipelineEvent{Type: IntentParsed, UserId: userId, ParserResponse: parserResponse})
+	userCommand, missingSlot := fillSlots(conversation, newUserCommand(session, parserResponse), command, config.Dialogue.Intents)
+	remoteBotAddress := config.DiscordChannel(session.guildId, session.voiceChannelId).RemoteBot
+	//checked after slots are filled since an answer to a prompt is parsed as its own intent
+	permitted, err := config.Permitted(session.guildId, userCommand.Intent.Name, remoteBotAddress, userId, session.roles)
+	if err != nil {
+		return nil, "", err
+	}
+	var remoteBotResponse *RemoteBotResponse
+	if !permitted {
+		zap.S().Warnf("user %s doesn't have permission to use intent %s with remote bot %s in guild %s", userId, userCommand.Intent.Name, remoteBotAddress, session.guildId)
+		//a prompt for an intent they can't use isn't left waiting for an answer
+		conversation.pending = nil
+		conversation.awaiting = ""
+		remoteBotResponse = &RemoteBotResponse{Text: permissionDeniedResponse, Understood: true}
+		notify(PipelineEvent{Type: PermissionDenied, UserId: userId, Text: userCommand.Intent.Name})
+	} else if missingSlot != nil {
+		//asking for the entity works like the remote bot wanting a reply
+		zap.S().Infof("Asking user for %s", missingSlot.Entity)
+		remoteBotResponse = &RemoteBotResponse{Text: missingSlot.Prompt, Understood: true, ExpectReply: true}
+		notify(PipelineEvent{Type: SlotPrompted, UserId: userId, Text: missingSlot.Prompt})
+	} else if allowed, wait := rateLimits.allow(remoteBotLimited, session.guildId, userId, config); !allowed {
+		zap.S().Infof("user %s is over the remote bot limit for another %s", userId, wait.Round(time.Second))
+		remoteBotResponse = &RemoteBotResponse{Text: config.Commands.RateLimits.Cooldown, Understood: true}
+		notify(PipelineEvent{Type: RateLimited, UserId: userId, Text: config.Commands.RateLimits.Cooldown})
+	} else {
+		//remote bot
+		remoteBotResponse, err = sendUserCommandToRemoteBot(ctx, remoteBotAddress, userCommand)
+		if err != nil {
+			return nil, "", err
+		}
+		notify(PipelineEvent{Type: RemoteBotResponded, UserId: userId, Text: remoteBotResponse.Text, RemoteBotResponse: remoteBotResponse})
+	}
+	if remoteBotResponse.Text != "" || remoteBotResponse.Understood {
+		zap.S().Info("Command understood by remote bot")
+		response = remoteBotResponse.Text
+	}
+	conversation.addTurn(ConversationTurn{Command: command, Intent: userCommand.Intent.Name, Response: response})
+	return remoteBotResponse, response, nil
+}
+
+//the callback lets the remote bot know the response has been given
+func callbackRemoteBot(remoteBotResponse *RemoteBotResponse) {
+	if remoteBotResponse.Callback == "" {
+		return
+	}
+	zap.S().Infof("callback to %s", remoteBotResponse.Callback)
+	client := http.Client{
+		Timeout: time.Duration(5 * time.Second),
+	}
+	client.Get(remoteBotResponse.Callback)
+	zap.S().Infof("finished callback to %s", remoteBotResponse.Callback)
+}
+
+func newUserCommand(session *CommandSession, parserResponse *RasaNLU.ParserResponse) *UserCommand {
+	conversation := session.conversation
+	userCommand := UserCommand{UserId: session.userId, GuildId: session.guildId, VoiceChannelId: session.voiceChannelId, Intent: parserResponse.Intent}
 	entities := make(map[string]string)
 	for _, entity := range parserResponse.Entities {
 		entities[entity.Entity] = entity.Value
 	}
 	userCommand.Entities = entities
+	userCommand.ConversationId = conversation.Id
+	userCommand.Turns = append([]ConversationTurn{}, conversation.Turns...)
 	return &userCommand
 }
@@ -0,0 +1,41 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/RasaNLU"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewUserCommand(t *testing.T) {
+	conversation := createConversation()
+	conversation.addTurn(ConversationTurn{Command: "play a horn", Intent: "playhorn", Response: "which sound?"})
+	session := &CommandSession{userId: "user1", guildId: "guild2", voiceChannelId: "voice2", conversation: conversation}
+	parserResponse := &RasaNLU.ParserResponse{
+		Intent:   RasaNLU.Intent{Name: "playhorn"},
+		Entities: []RasaNLU.Entity{{Entity: "horntype", Value: "fog"}},
+	}
+	userCommand := newUserCommand(session, parserResponse)
+	if userCommand.UserId != "user1" || userCommand.GuildId != "guild2" || userCommand.VoiceChannelId != "voice2" {
+		t.Errorf("expected the command to come from the sessions channel got %+v", userCommand)
+	}
+	if userCommand.Entities["horntype"] != "fog" || userCommand.ConversationId != conversation.Id || len(userCommand.Turns) != 1 {
+		t.Errorf("unexpected command %+v", userCommand)
+	}
+	//later turns don't change a command that has already been built
+	conversation.addTurn(ConversationTurn{Command: "fog"})
+	if len(userCommand.Turns) != 1 {
+		t.Errorf("expected the turns to be copied got %d", len(userCommand.Turns))
+	}
+}
+
+func TestRemoteBotFailureReason(t *testing.T) {
+	//closed straight away so nothing is listening at the address
+	remoteBot := httptest.NewServer(nil)
+	remoteBot.Close()
+	_, err := sendUserCommandToRemoteBot(context.Background(), remoteBot.URL, &UserCommand{})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the reason the remote bot failed got %v", err)
+	}
+}
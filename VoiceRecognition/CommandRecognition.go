@@ -1,80 +1,90 @@
 package VoiceRecognition
 
 import (
-	speech "cloud.google.com/go/speech/apiv1"
 	"context"
 	"go.uber.org/zap"
-	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
 	"gopkg.in/hraban/opus.v2"
-	"io"
+	"sync"
 	"time"
 )
 
 type CommandRecognition struct {
-	client                   *speech.Client
-	streamingRecognizeClient speechpb.Speech_StreamingRecognizeClient
-	VoiceInfoRecv            chan *VoiceInfo
-	opusDecoder              *opus.Decoder
-	commandNotify            chan<- string
-	close                    chan bool
+	ssrc          uint32
+	stream        SpeechToTextStream
+	VoiceInfoRecv chan *VoiceInfo
+	opusDecoder   *opus.Decoder
+	commandNotify chan<- CommandSpokenNotify
+	//listenFor is how long to listen before giving up on the user finishing, 0 listens until closed
+	listenFor time.Duration
+	stop      chan bool
+	stopOnce  sync.Once
 }
 
-func createCommandRecognition(commandNotify chan<- string) *CommandRecognition {
-	opusDecoder, err := opus.NewDecoder(48000, 2)
-	if err != nil {
-		zap.S().Fatalf("Failed to create opus decoder for command recognition")
-	}
-	ctx := context.Background()
+type CommandSpokenNotify struct {
+	ssrc    uint32
+	command string
+	//confidence is 0 when the speech to text doesn't give one
+	confidence float32
+}
 
-	client, err := speech.NewClient(ctx)
+//listenFor is the sessions listening timeout so the state machine and recognition agree on when to stop
+func createCommandRecognition(ssrc uint32, commandNotify chan<- CommandSpokenNotify, speechToText SpeechToText, listenFor time.Duration) (*CommandRecognition, error) {
+	opusDecoder, err := opus.NewDecoder(48000, 2)
 	if err != nil {
-		zap.S().Fatal(err)
+		return nil, err
 	}
-	stream, err := client.StreamingRecognize(ctx)
+	stream, err := speechToText.StartStream(context.Background())
 	if err != nil {
-		zap.S().Fatal(err)
-	}
-
-	if err := stream.Send(&speechpb.StreamingRecognizeRequest{
-		StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
-			StreamingConfig: &speechpb.StreamingRecognitionConfig{
-				Config: &speechpb.RecognitionConfig{
-					Encoding:        speechpb.RecognitionConfig_LINEAR16,
-					SampleRateHertz: discordSampleRate,
-					LanguageCode:    "en-GB",
-				},
-				SingleUtterance: true,
-			},
-		},
-	}); err != nil {
-		zap.S().Fatal(err)
+		return nil, err
 	}
 
 	//dont know if i need a buffer for the packets
 	//should decode fast enough
 	cr := &CommandRecognition{
-		client:                   client,
-		streamingRecognizeClient: stream,
-		VoiceInfoRecv:            make(chan *VoiceInfo, 1000),
-		opusDecoder:              opusDecoder,
-		commandNotify:            commandNotify,
-		close:                    make(chan bool),
+		ssrc:          ssrc,
+		stream:        stream,
+		VoiceInfoRecv: make(chan *VoiceInfo, 1000),
+		opusDecoder:   opusDecoder,
+		commandNotify: commandNotify,
+		listenFor:     listenFor,
+		stop:          make(chan bool),
 	}
 	go cr.voiceRecv()
 	go cr.readResponse()
-	return cr
+	return cr, nil
+
+}
 
+//Close stops listening to the user. a command that has not been notified yet is dropped
+func (cr *CommandRecognition) Close() {
+	cr.stopOnce.Do(func() {
+		close(cr.stop)
+	})
 }
 
 func (cr *CommandRecognition) voiceRecv() {
 	ticker := time.NewTicker(20 * time.Millisecond)
-	timeout := time.NewTimer(15 * time.Second)
-	defer timeout.Stop()
+	defer ticker.Stop()
+	var timeout <-chan time.Time
+	if cr.listenFor > 0 {
+		timer := time.NewTimer(cr.listenFor)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	defer func() {
+		if err := cr.stream.Close(); err != nil {
+			zap.S().Infof("Could not close stream: %v", err)
+		}
+	}()
 	speaking := false
+	endpointer, _ := cr.stream.(UtteranceEndpointer)
 	for {
 		select {
 		case voiceInfo := <-cr.VoiceInfoRecv:
 			pcm := make([]int16, frameSizeStereo)
+			if endpointer != nil && voiceInfo.speaking != speaking {
+				endpointer.SpeakingChanged(voiceInfo.speaking)
+			}
 			if !voiceInfo.speaking {
 				speaking = false
 				continue
@@ -91,70 +101,47 @@ func (cr *CommandRecognition) voiceRecv() {
 				continue
 			}
 			cr.sendVoice(silencePacketPCM)
-		case <-timeout.C:
-			if err := cr.streamingRecognizeClient.CloseSend(); err != nil {
-				zap.S().Infof("Could not close stream: %v", err)
-			}
-			if err := cr.client.Close(); err != nil {
-				zap.S().Infof("Could not close client: %v", err)
-			}
+		case <-timeout:
 			return
-		case <-cr.close:
-			if err := cr.streamingRecognizeClient.CloseSend(); err != nil {
-				zap.S().Fatalf("Could not close stream: %v", err)
-			}
-			if err := cr.client.Close(); err != nil {
-				zap.S().Fatalf("Could not close client: %v", err)
-			}
+		case <-cr.stop:
 			return
 		}
 	}
 }
 
 func (cr *CommandRecognition) readResponse() {
-	for {
-		resp, err := cr.streamingRecognizeClient.Recv()
-		if err == io.EOF {
-			return
-		}
-		if err != nil {
-			zap.S().Infof("Cannot stream results: %v", err)
-			cr.commandNotify <- ""
-			cr.close <- true
-			return
+	for transcript := range cr.stream.Transcripts() {
+		if !transcript.Final {
+			zap.S().Debugf("interim command transcript \"%s\"", transcript.Text)
+			continue
 		}
-		if err := resp.Error; err != nil {
-			// Workaround while the API doesn't give a more informative error.
-			if err.Code == 3 || err.Code == 11 {
-				zap.S().Info("WARNING: Speech recognition request exceeded limit of 60 seconds.")
-
-			}
-			zap.S().Infof("Could not recognize: %v", err)
-			cr.commandNotify <- ""
-			cr.close <- true
-			return
+		for _, segment := range transcript.Segments {
+			zap.S().Infof("command segment \"%s\" from %s to %s with confidence %.2f", segment.Text, segment.Start, segment.End, segment.Confidence)
 		}
-		for _, result := range resp.Results {
-			cr.commandNotify <- result.Alternatives[0].Transcript
-			cr.close <- true
-			return
+		cr.notifyCommand(transcript.Text, transcript.Confidence)
+		cr.Close()
+		//let the stream finish up
+		for range cr.stream.Transcripts() {
 		}
+		return
+	}
+	if err := cr.stream.Err(); err != nil {
+		zap.S().Infof("Could not recognize command: %v", err)
 	}
+	cr.notifyCommand("", 0)
+	cr.Close()
 }
 
-func (cr *CommandRecognition) sendVoice(pcm []int16) {
-	//could mabye use a two channel configuration for google speech recognition removing the need to convert to mono
-	pcmMono := convertPCMToMono(pcm)
-	pcmBytes, err := int16SliceToByteSlice(pcmMono)
-	if err != nil {
-		zap.S().Warn("Failed to convert int16 pcm to byte slice for command recognition")
-		return
+//nothing is listening for the command any more once stopped
+func (cr *CommandRecognition) notifyCommand(command string, confidence float32) {
+	select {
+	case cr.commandNotify <- CommandSpokenNotify{ssrc: cr.ssrc, command: command, confidence: confidence}:
+	case <-cr.stop:
 	}
-	if err := cr.streamingRecognizeClient.Send(&speechpb.StreamingRecognizeRequest{
-		StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
-			AudioContent: pcmBytes,
-		},
-	}); err != nil {
+}
+
+func (cr *CommandRecognition) sendVoice(pcm []int16) {
+	if err := cr.stream.SendPCM(pcm); err != nil {
 		zap.S().Warnf("Could not send audio: %v", err)
 	}
 }
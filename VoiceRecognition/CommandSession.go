@@ -0,0 +1,84 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"strings"
+	"time"
+)
+
+//cancelPhrases stop the speakers command whether it is still being listened to or the response is
+//being read out. sphinx spots them alongside the key phrase
+var cancelPhrases = []string{"cancel", "lydia stop"}
+
+//CommandSession is one user giving a command, from saying the key phrase until the response
+//has been read out. every user gets their own session so they can give commands at the same time.
+//follow up replies stay in the same session
+type CommandSession struct {
+	ssrc   uint32
+	userId string
+	//guildId and voiceChannelId are where the command came from
+	guildId        string
+	voiceChannelId string
+	state          *SessionStateMachine
+	conversation   *Conversation
+	//roles looks up the users roles for checking permissions, nil if they have none
+	roles func() ([]string, error)
+	//ctx is cancelled once the session is back to idle so processing and playback stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	//commandRecognition is only set while listening
+	commandRecognition *CommandRecognition
+}
+
+type sessionEventNotify struct {
+	session *CommandSession
+	event   SessionEvent
+}
+
+type sessionTimeoutNotify struct {
+	session *CommandSession
+	timeout SessionTimeout
+}
+
+func (cs *CommandSession) listening() bool {
+	return cs.commandRecognition != nil
+}
+
+//stopListening closes command recognition. safe to call once the command has been heard
+func (cs *CommandSession) stopListening() {
+	if cs.commandRecognition != nil {
+		cs.commandRecognition.Close()
+		cs.commandRecognition = nil
+	}
+}
+
+//config timeouts replace the defaults when they are set
+func sessionTimeoutsFromConfig(config Config.Config) SessionTimeouts {
+	timeouts := make(SessionTimeouts)
+	for state, timeout := range defaultSessionTimeouts {
+		timeouts[state] = timeout
+	}
+	for state, timeout := range map[SessionState]time.Duration{
+		WakeDetected:  config.Commands.Timeouts.Wake,
+		Listening:     config.Commands.Timeouts.Listening,
+		Understanding: config.Commands.Timeouts.Understanding,
+		Responding:    config.Commands.Timeouts.Responding,
+		FollowUp:      config.Commands.Timeouts.FollowUp,
+	} {
+		if timeout > 0 {
+			timeouts[state] = timeout
+		}
+	}
+	return timeouts
+}
+
+func isCancelPhrase(text string) bool {
+	text = strings.ToLower(strings.Trim(text, " .!?,"))
+	for _, phrase := range cancelPhrases {
+		if text == phrase {
+			return true
+		}
+	}
+	return false
+}
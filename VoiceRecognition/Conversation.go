@@ -0,0 +1,39 @@
+package VoiceRecognition
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+//only the most recent turns are sent to the remote bot so long conversations don't keep growing
+const maxConversationTurns = 10
+
+//ConversationTurn is one command and what the remote bot said back
+type ConversationTurn struct {
+	Command  string `json:"command"`
+	Intent   string `json:"intent"`
+	Response string `json:"response"`
+}
+
+//Conversation lasts from the key phrase until the remote bot stops expecting a reply. it is
+//only touched by whatever is processing the current command
+type Conversation struct {
+	Id    string
+	Turns []ConversationTurn
+	//pending is a command waiting for the user to give the awaiting entity
+	pending  *UserCommand
+	awaiting string
+}
+
+func createConversation() *Conversation {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Conversation{Id: hex.EncodeToString(id)}
+}
+
+func (c *Conversation) addTurn(turn ConversationTurn) {
+	c.Turns = append(c.Turns, turn)
+	if len(c.Turns) > maxConversationTurns {
+		c.Turns = c.Turns[len(c.Turns)-maxConversationTurns:]
+	}
+}
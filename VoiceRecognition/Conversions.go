@@ -86,3 +86,33 @@ func convertPCMToMono(pcm []int16) []int16 {
 	}
 	return monoPCM
 }
+
+//downsamples discord pcm to 16khz mono for local recognisers. the resampler needs a decent
+//amount of audio at once so 20ms frames are buffered until there is enough
+type pcmDownsampleBuffer struct {
+	pcm []int16
+}
+
+func (b *pcmDownsampleBuffer) push(pcm []int16) ([]int16, error) {
+	b.pcm = append(b.pcm, pcm...)
+	if len(b.pcm) < amountOfSamplesNeededToResample {
+		return nil, nil
+	}
+	return b.flush()
+}
+
+//pads whatever is left with silence so it can be resampled
+func (b *pcmDownsampleBuffer) flush() ([]int16, error) {
+	if len(b.pcm) == 0 {
+		return nil, nil
+	}
+	for len(b.pcm) < amountOfSamplesNeededToResample {
+		b.pcm = append(b.pcm, silencePacketPCM...)
+	}
+	resampledPCM, err := resamplePCM(b.pcm)
+	b.pcm = nil
+	if err != nil {
+		return nil, err
+	}
+	return convertPCMToMono(resampledPCM), nil
+}
@@ -0,0 +1,35 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"strings"
+)
+
+//fillSlots sits between rasa and the remote bot. if the conversation is waiting on an entity the
+//new command is treated as the answer and merged into the waiting command. the returned slot is
+//the first required entity still missing, nil means the command can go to the remote bot
+func fillSlots(conversation *Conversation, userCommand *UserCommand, command string, intents map[string]Config.DialogueIntent) (*UserCommand, *Config.DialogueSlot) {
+	if pending := conversation.pending; pending != nil {
+		for entity, value := range userCommand.Entities {
+			if _, exists := pending.Entities[entity]; !exists {
+				pending.Entities[entity] = value
+			}
+		}
+		//short answers like "fog horn" often don't parse as an entity on their own
+		if _, exists := pending.Entities[conversation.awaiting]; !exists {
+			pending.Entities[conversation.awaiting] = strings.TrimSpace(command)
+		}
+		pending.Turns = userCommand.Turns
+		userCommand = pending
+		conversation.pending = nil
+		conversation.awaiting = ""
+	}
+	for _, slot := range intents[userCommand.Intent.Name].Slots {
+		if _, exists := userCommand.Entities[slot.Entity]; !exists {
+			conversation.pending = userCommand
+			conversation.awaiting = slot.Entity
+			return userCommand, &slot
+		}
+	}
+	return userCommand, nil
+}
@@ -0,0 +1,60 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/RasaNLU"
+	"testing"
+)
+
+var testDialogueIntents = map[string]Config.DialogueIntent{
+	"playhorn": {Slots: []Config.DialogueSlot{{Entity: "horntype", Prompt: "which sound?"}}},
+}
+
+func parsedCommand(intent string, entities map[string]string) *UserCommand {
+	return &UserCommand{UserId: "user1", Intent: RasaNLU.Intent{Name: intent}, Entities: entities}
+}
+
+func TestFillSlotsComplete(t *testing.T) {
+	conversation := createConversation()
+	userCommand, slot := fillSlots(conversation, parsedCommand("playhorn", map[string]string{"horntype": "air horn"}), "play air horn", testDialogueIntents)
+	if slot != nil {
+		t.Errorf("expected a complete command got asked for %s", slot.Entity)
+	}
+	if userCommand.Entities["horntype"] != "air horn" {
+		t.Errorf("unexpected entities %v", userCommand.Entities)
+	}
+	//intents without slots go straight through
+	if _, slot := fillSlots(conversation, parsedCommand("greet", map[string]string{}), "hello", testDialogueIntents); slot != nil {
+		t.Errorf("expected greet to need nothing got asked for %s", slot.Entity)
+	}
+}
+
+func TestFillSlotsAsksThenMerges(t *testing.T) {
+	conversation := createConversation()
+	_, slot := fillSlots(conversation, parsedCommand("playhorn", map[string]string{}), "play a horn", testDialogueIntents)
+	if slot == nil || slot.Prompt != "which sound?" {
+		t.Fatalf("expected to be asked which sound got %+v", slot)
+	}
+	//the answer parses as something else but its entity still fills the slot
+	answer := parsedCommand("greet", map[string]string{"horntype": "fog horn"})
+	answer.Turns = []ConversationTurn{{Command: "play a horn", Response: "which sound?"}}
+	userCommand, slot := fillSlots(conversation, answer, "fog horn", testDialogueIntents)
+	if slot != nil {
+		t.Fatalf("expected the answer to complete the command got asked for %s", slot.Entity)
+	}
+	if userCommand.Intent.Name != "playhorn" || userCommand.Entities["horntype"] != "fog horn" || len(userCommand.Turns) != 1 {
+		t.Errorf("unexpected merged command %+v", userCommand)
+	}
+	if conversation.pending != nil {
+		t.Error("expected nothing to be waiting once the command is complete")
+	}
+}
+
+func TestFillSlotsUnparsedAnswer(t *testing.T) {
+	conversation := createConversation()
+	fillSlots(conversation, parsedCommand("playhorn", map[string]string{}), "play a horn", testDialogueIntents)
+	userCommand, slot := fillSlots(conversation, parsedCommand("", map[string]string{}), " fog horn ", testDialogueIntents)
+	if slot != nil || userCommand.Entities["horntype"] != "fog horn" {
+		t.Errorf("expected the whole answer to be used got %v", userCommand.Entities)
+	}
+}
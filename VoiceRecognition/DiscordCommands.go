@@ -0,0 +1,309 @@
+package VoiceRecognition
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"strings"
+)
+
+//commandName is the slash command everything is under e.g. /lydia ask
+const commandName = "lydia"
+
+//askSubcommand types a command instead of saying it
+const askSubcommand = "ask"
+
+//listenSubcommand pushes to talk, the reply has a talkButton to push to talk again
+const (
+	listenSubcommand = "listen"
+	talkButton       = "lydia-talk"
+)
+
+//permissionsGroup has a subcommand for each PermissionAction e.g. /lydia permissions allow
+const permissionsGroup = "permissions"
+
+//RegisterCommands registers the /lydia slash command. join and leave are only there when following users
+func (ds *DiscordSession) RegisterCommands(follow bool) error {
+	command := &discordgo.ApplicationCommand{
+		Name:        commandName,
+		Description: "Voice recognition",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        askSubcommand,
+				Description: "Type a command instead of saying it",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "command",
+						Description: "What you would have said e.g. play fog horn",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        listenSubcommand,
+				Description: "Start a command without saying the wake word",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        permissionsGroup,
+				Description: "Who can use intents and remote bots",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        string(PermissionAllow),
+						Description: "Let a role or user use an intent or remote bot, no one else can unless allowed too",
+						Options:     permissionOptions(),
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        string(PermissionRevoke),
+						Description: "Stop a role or user using an intent or remote bot, nobody can once everyone is revoked",
+						Options:     permissionOptions(),
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        string(PermissionOpen),
+						Description: "Let everyone use an intent or remote bot again",
+						Options:     permissionOptions()[:2],
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        string(PermissionList),
+						Description: "Show who can use what",
+					},
+				},
+			},
+		},
+	}
+	if follow {
+		command.Options = append(command.Options,
+			&discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        string(SummonJoin),
+				Description: "Join your voice channel, or move to it",
+			},
+			&discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        string(SummonLeave),
+				Description: "Leave the voice channel",
+			},
+		)
+	}
+	//creating a command with the same name replaces it so join and leave go away when no longer following
+	_, err := ds.session.ApplicationCommandCreate(ds.session.State.User.ID, "", command)
+	return err
+}
+
+//TextCommands reports /lydia ask and messages that mention the bot. the commands need registering with RegisterCommands
+func (ds *DiscordSession) TextCommands() <-chan TextCommand {
+	textCommands := make(chan TextCommand)
+	ds.session.AddHandler(func(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+		if interaction.Type != discordgo.InteractionApplicationCommand || interaction.Member == nil {
+			return
+		}
+		data := interaction.ApplicationCommandData()
+		if data.Name != commandName || len(data.Options) == 0 || data.Options[0].Name != askSubcommand || len(data.Options[0].Options) == 0 {
+			return
+		}
+		textCommand := TextCommand{
+			GuildId:        interaction.GuildID,
+			TextChannelId:  interaction.ChannelID,
+			VoiceChannelId: ds.userVoiceChannel(interaction.GuildID, interaction.Member.User.ID),
+			UserId:         interaction.Member.User.ID,
+			Roles:          interaction.Member.Roles,
+			Text:           data.Options[0].Options[0].StringValue(),
+			Reply:          ds.deferredReply(interaction.Interaction, askSubcommand),
+		}
+		//everyone can see the answer like they would have heard it
+		ds.respond(interaction.Interaction, discordgo.InteractionResponseDeferredChannelMessageWithSource, "", false)
+		select {
+		case textCommands <- textCommand:
+		case <-ds.closed:
+		}
+	})
+	//discord includes the content of messages that mention the bot without needing the message content intent
+	ds.session.AddHandler(func(session *discordgo.Session, message *discordgo.MessageCreate) {
+		if message.GuildID == "" || message.Author == nil || message.Author.Bot || !mentions(message.Message, session.State.User.ID) {
+			return
+		}
+		text := message.Content
+		for _, mention := range []string{"<@" + session.State.User.ID + ">", "<@!" + session.State.User.ID + ">"} {
+			text = strings.ReplaceAll(text, mention, "")
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		reference := message.Reference()
+		//discord sends the members roles with messages in guilds
+		var roles []string
+		if message.Member != nil {
+			roles = message.Member.Roles
+		}
+		textCommand := TextCommand{
+			GuildId:        message.GuildID,
+			TextChannelId:  message.ChannelID,
+			VoiceChannelId: ds.userVoiceChannel(message.GuildID, message.Author.ID),
+			UserId:         message.Author.ID,
+			Roles:          roles,
+			Text:           text,
+			Mentioned:      true,
+			Reply: func(reply string) {
+				if _, err := ds.session.ChannelMessageSendReply(message.ChannelID, reply, reference); err != nil {
+					zap.S().Warnf("Failed to reply to message %s: %s", message.ID, err)
+				}
+			},
+		}
+		select {
+		case textCommands <- textCommand:
+		case <-ds.closed:
+		}
+	})
+	return textCommands
+}
+
+//PushToTalkRequests reports /lydia listen and presses of the talk button in its reply. the commands need
+//registering with RegisterCommands
+func (ds *DiscordSession) PushToTalkRequests() <-chan PushToTalkRequest {
+	requests := make(chan PushToTalkRequest)
+	ds.session.AddHandler(func(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+		if interaction.Member == nil {
+			return
+		}
+		//the reply replaces the message with the button so pressing it again doesn't leave a trail of replies
+		responseType := discordgo.InteractionResponseDeferredMessageUpdate
+		switch interaction.Type {
+		case discordgo.InteractionApplicationCommand:
+			data := interaction.ApplicationCommandData()
+			if data.Name != commandName || len(data.Options) == 0 || data.Options[0].Name != listenSubcommand {
+				return
+			}
+			responseType = discordgo.InteractionResponseDeferredChannelMessageWithSource
+		case discordgo.InteractionMessageComponent:
+			if interaction.MessageComponentData().CustomID != talkButton {
+				return
+			}
+		default:
+			return
+		}
+		request := PushToTalkRequest{
+			GuildId:        interaction.GuildID,
+			VoiceChannelId: ds.userVoiceChannel(interaction.GuildID, interaction.Member.User.ID),
+			UserId:         interaction.Member.User.ID,
+			Reply: func(message string) {
+				components := []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Talk", Style: discordgo.PrimaryButton, CustomID: talkButton},
+				}}}
+				edit := &discordgo.WebhookEdit{Content: &message, Components: &components}
+				if _, err := ds.session.InteractionResponseEdit(interaction.Interaction, edit); err != nil {
+					zap.S().Warnf("Failed to reply to /%s %s: %s", commandName, listenSubcommand, err)
+				}
+			},
+		}
+		//only the user who pushed to talk sees the button so no one else can press it for them
+		ds.respond(interaction.Interaction, responseType, "", true)
+		select {
+		case requests <- request:
+		case <-ds.closed:
+		}
+	})
+	return requests
+}
+
+//PermissionRequests reports /lydia permissions. only users who can manage the server can allow or revoke.
+//the commands need registering with RegisterCommands
+func (ds *DiscordSession) PermissionRequests() <-chan PermissionRequest {
+	requests := make(chan PermissionRequest)
+	ds.session.AddHandler(func(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+		if interaction.Type != discordgo.InteractionApplicationCommand || interaction.Member == nil {
+			return
+		}
+		data := interaction.ApplicationCommandData()
+		if data.Name != commandName || len(data.Options) == 0 || data.Options[0].Name != permissionsGroup || len(data.Options[0].Options) == 0 {
+			return
+		}
+		subcommand := data.Options[0].Options[0]
+		request := PermissionRequest{
+			Action:      PermissionAction(subcommand.Name),
+			GuildId:     interaction.GuildID,
+			RequestedBy: interaction.Member.User.ID,
+			Reply:       ds.deferredReply(interaction.Interaction, permissionsGroup+" "+subcommand.Name),
+		}
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "intent":
+				request.Intent = option.StringValue()
+			case "remotebot":
+				request.RemoteBot = option.StringValue()
+			case "role":
+				request.RoleId = option.RoleValue(nil, "").ID
+			case "user":
+				request.UserId = option.UserValue(nil).ID
+			}
+		}
+		manager := interaction.Member.Permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+		if request.Action != PermissionList && !manager {
+			zap.S().Infof("user %s tried to %s permissions without being able to manage the server", request.RequestedBy, request.Action)
+			ds.respond(interaction.Interaction, discordgo.InteractionResponseChannelMessageWithSource, "You need the Manage Server permission to change permissions", true)
+			return
+		}
+		ds.respond(interaction.Interaction, discordgo.InteractionResponseDeferredChannelMessageWithSource, "", true)
+		select {
+		case requests <- request:
+		case <-ds.closed:
+		}
+	})
+	return requests
+}
+
+//permissionOptions are what a permission is for and who gets it, one of each is expected. open only takes
+//the first two
+func permissionOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "intent", Description: "The intent e.g. playhorn"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "remotebot", Description: "The remote bot address"},
+		{Type: discordgo.ApplicationCommandOptionRole, Name: "role", Description: "Everyone with the role"},
+		{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "A single user"},
+	}
+}
+
+func mentions(message *discordgo.Message, userId string) bool {
+	for _, user := range message.Mentions {
+		if user.ID == userId {
+			return true
+		}
+	}
+	return false
+}
+
+//userVoiceChannel is empty if the user isn't in a voice channel
+func (ds *DiscordSession) userVoiceChannel(guildId string, userId string) string {
+	voiceState, err := ds.session.State.VoiceState(guildId, userId)
+	if err != nil {
+		return ""
+	}
+	return voiceState.ChannelID
+}
+
+//respond answers an interaction straight away, ephemeral responses are only shown to the user who ran the command
+func (ds *DiscordSession) respond(interaction *discordgo.Interaction, responseType discordgo.InteractionResponseType, message string, ephemeral bool) {
+	data := &discordgo.InteractionResponseData{Content: message}
+	if ephemeral {
+		data.Flags = discordgo.MessageFlagsEphemeral
+	}
+	err := ds.session.InteractionRespond(interaction, &discordgo.InteractionResponse{Type: responseType, Data: data})
+	if err != nil {
+		zap.S().Warnf("Failed to respond to /%s: %s", commandName, err)
+	}
+}
+
+//deferredReply fills in a deferred response once the command has been handled
+func (ds *DiscordSession) deferredReply(interaction *discordgo.Interaction, subcommand string) func(message string) {
+	return func(message string) {
+		if _, err := ds.session.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{Content: &message}); err != nil {
+			zap.S().Warnf("Failed to reply to /%s %s: %s", commandName, subcommand, err)
+		}
+	}
+}
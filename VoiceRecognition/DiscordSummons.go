@@ -0,0 +1,99 @@
+package VoiceRecognition
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+//Summons reports /lydia join and /lydia leave, along with how many users are left in a voice channel
+//whenever someone joins, leaves or moves. the commands need registering with RegisterCommands
+func (ds *DiscordSession) Summons() (<-chan Summon, <-chan ChannelOccupancy) {
+	summons := make(chan Summon)
+	occupancy := make(chan ChannelOccupancy)
+	ds.session.AddHandler(func(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+		ds.handleSummon(interaction, summons)
+	})
+	//the state has already been updated by the time handlers are called so the counts include this change
+	ds.session.AddHandler(func(session *discordgo.Session, state *discordgo.VoiceStateUpdate) {
+		channels := []string{state.ChannelID}
+		if state.BeforeUpdate != nil && state.BeforeUpdate.ChannelID != state.ChannelID {
+			channels = append(channels, state.BeforeUpdate.ChannelID)
+		}
+		for _, channelId := range channels {
+			if channelId == "" {
+				continue
+			}
+			users, err := ds.usersInVoiceChannel(state.GuildID, channelId)
+			if err != nil {
+				zap.S().Debug(err)
+				continue
+			}
+			select {
+			case occupancy <- ChannelOccupancy{GuildId: state.GuildID, VoiceChannelId: channelId, Users: users}:
+			case <-ds.closed:
+				return
+			}
+		}
+	})
+	return summons, occupancy
+}
+
+//joining a voice channel can take longer than discord waits for an answer so the response is deferred
+//and filled in once the summon has been handled
+func (ds *DiscordSession) handleSummon(interaction *discordgo.InteractionCreate, summons chan<- Summon) {
+	if interaction.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := interaction.ApplicationCommandData()
+	if data.Name != commandName || len(data.Options) == 0 {
+		return
+	}
+	subcommand := data.Options[0].Name
+	if subcommand != string(SummonJoin) && subcommand != string(SummonLeave) {
+		return
+	}
+	if interaction.Member == nil {
+		ds.respond(interaction.Interaction, discordgo.InteractionResponseChannelMessageWithSource, "I can only join voice channels in a server", true)
+		return
+	}
+	summon := Summon{
+		Action:         SummonAction(subcommand),
+		GuildId:        interaction.GuildID,
+		UserId:         interaction.Member.User.ID,
+		VoiceChannelId: ds.userVoiceChannel(interaction.GuildID, interaction.Member.User.ID),
+		Reply:          ds.deferredReply(interaction.Interaction, subcommand),
+	}
+	ds.respond(interaction.Interaction, discordgo.InteractionResponseDeferredChannelMessageWithSource, "", true)
+	select {
+	case summons <- summon:
+	case <-ds.closed:
+	}
+}
+
+//bots aren't counted so the bot leaves when it is only other bots left
+func (ds *DiscordSession) usersInVoiceChannel(guildId string, channelId string) (int, error) {
+	guild, err := ds.session.State.Guild(guildId)
+	if err != nil {
+		return 0, err
+	}
+	var userIds []string
+	ds.session.State.RLock()
+	for _, voiceState := range guild.VoiceStates {
+		if voiceState.ChannelID == channelId {
+			userIds = append(userIds, voiceState.UserID)
+		}
+	}
+	ds.session.State.RUnlock()
+	users := 0
+	for _, userId := range userIds {
+		if userId == ds.session.State.User.ID {
+			continue
+		}
+		//members that aren't cached are counted so the bot doesn't leave someone behind
+		if member, err := ds.session.State.Member(guildId, userId); err == nil && member.User != nil && member.User.Bot {
+			continue
+		}
+		users++
+	}
+	return users, nil
+}
@@ -0,0 +1,88 @@
+package VoiceRecognition
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"sort"
+	"strings"
+	"time"
+)
+
+//embed colours for how an interaction ended
+const (
+	mirrorColourAnswered  = 0x43b581
+	mirrorColourCancelled = 0x99aab5
+	mirrorColourFailed    = 0xf04747
+)
+
+//discord rejects the whole embed if any field is over these limits or empty
+const (
+	embedDescriptionLimit = 4096
+	embedFieldLimit       = 1024
+	embedEmptyValue       = "-"
+)
+
+//mirrorErrorText is posted instead of the error itself, errors can have remote bot and rasa addresses or
+//response bodies in them so they are only logged
+const mirrorErrorText = "something went wrong"
+
+//PostInteraction posts the interaction as an embed. the user is mentioned in the embed so they aren't pinged
+func (ds *DiscordSession) PostInteraction(textChannelId string, interaction MirroredInteraction) error {
+	_, err := ds.session.ChannelMessageSendEmbed(textChannelId, interactionEmbed(interaction))
+	return err
+}
+
+func interactionEmbed(interaction MirroredInteraction) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Description: embedText(fmt.Sprintf("<@%s> said %q", interaction.UserId, interaction.Transcript), embedDescriptionLimit),
+		Color:       mirrorColourAnswered,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Footer:      &discordgo.MessageEmbedFooter{Text: string(interaction.Ended)},
+	}
+	switch interaction.Ended {
+	case Cancelled:
+		embed.Color = mirrorColourCancelled
+	case Failed, TimedOut:
+		embed.Color = mirrorColourFailed
+	}
+	if interaction.ParserResponse != nil {
+		intent := interaction.ParserResponse.Intent
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Intent",
+			Value:  embedText(fmt.Sprintf("%s (%.0f%%)", intent.Name, intent.Confidence*100), embedFieldLimit),
+			Inline: true,
+		})
+		var entities []string
+		for _, entity := range interaction.ParserResponse.Entities {
+			entities = append(entities, fmt.Sprintf("%s: %s", entity.Entity, entity.Value))
+		}
+		if len(entities) > 0 {
+			sort.Strings(entities)
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   "Entities",
+				Value:  embedText(strings.Join(entities, "\n"), embedFieldLimit),
+				Inline: true,
+			})
+		}
+	}
+	if interaction.Response != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Response", Value: embedText(interaction.Response, embedFieldLimit)})
+	}
+	if interaction.Err != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Error", Value: mirrorErrorText})
+	}
+	return embed
+}
+
+//embedText fills in empty text and cuts long text down to limit runes, ending with … so it is clear
+//something is missing
+func embedText(text string, limit int) string {
+	if strings.TrimSpace(text) == "" {
+		return embedEmptyValue
+	}
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,36 @@
+package VoiceRecognition
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInteractionEmbedHidesErrors(t *testing.T) {
+	err := errors.New("Non 200 status code from http://10.0.0.5:8080/: Body: internal details")
+	embed := interactionEmbed(MirroredInteraction{UserId: "user", Transcript: "play horn", Ended: Failed, Err: err})
+	for _, field := range embed.Fields {
+		if strings.Contains(field.Value, "10.0.0.5") {
+			t.Errorf("expected the error to be left out of the post got %q", field.Value)
+		}
+	}
+	if last := embed.Fields[len(embed.Fields)-1]; last.Name != "Error" || last.Value != mirrorErrorText {
+		t.Errorf("expected a generic error got %+v", last)
+	}
+}
+
+func TestInteractionEmbedLimits(t *testing.T) {
+	long := strings.Repeat("é", 5000)
+	embed := interactionEmbed(MirroredInteraction{UserId: "user", Transcript: long, Response: long, Ended: ResponseFinished})
+	if length := len([]rune(embed.Description)); length > embedDescriptionLimit {
+		t.Errorf("expected the description to be cut to %d runes got %d", embedDescriptionLimit, length)
+	}
+	for _, field := range embed.Fields {
+		if length := len([]rune(field.Value)); length > embedFieldLimit || length == 0 {
+			t.Errorf("expected %s to be between 1 and %d runes got %d", field.Name, embedFieldLimit, length)
+		}
+	}
+	if embedText(" ", embedFieldLimit) != embedEmptyValue {
+		t.Error("expected an empty value to get a placeholder")
+	}
+}
@@ -0,0 +1,221 @@
+package VoiceRecognition
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"sync"
+)
+
+//DiscordSession is the connection to discord shared by every voice channel the bot is in
+type DiscordSession struct {
+	session *discordgo.Session
+	//closed stops handlers waiting to report summons once nothing is listening
+	closed chan bool
+}
+
+//DiscordVOIPService is one voice channel on a shared discord session
+type DiscordVOIPService struct {
+	session           *discordgo.Session
+	voiceConnection   *discordgo.VoiceConnection
+	guildId           string
+	channelId         string
+	opusRecv          chan *VoicePacket
+	speakerConnect    chan Speaker
+	speakerDisconnect chan string
+	leave             chan bool
+	//connected are the users seen speaking in the channel, only they can disconnect from it. the handlers
+	//run on discordgos goroutines so it has its own lock
+	connectedMutex sync.Mutex
+	connected      map[string]bool
+	//removeHandlers takes the handlers added when joining off the shared session
+	removeHandlers []func()
+}
+
+func CreateDiscordSession(token string) (*DiscordSession, error) {
+	//discordgo logs through zap so the token is redacted the same as everything else
+	discordgo.Logger = logDiscord
+	discord, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, err
+	}
+	if err := discord.Open(); err != nil {
+		return nil, err
+	}
+	return &DiscordSession{session: discord, closed: make(chan bool)}, nil
+}
+
+//VOIPService creates a service for one voice channel. each channel the bot joins needs its own
+func (ds *DiscordSession) VOIPService() *DiscordVOIPService {
+	return &DiscordVOIPService{
+		session:           ds.session,
+		opusRecv:          make(chan *VoicePacket),
+		speakerConnect:    make(chan Speaker),
+		speakerDisconnect: make(chan string),
+	}
+}
+
+//Close disconnects from discord. voip services should be closed first
+func (ds *DiscordSession) Close() error {
+	close(ds.closed)
+	return ds.session.Close()
+}
+
+func (d *DiscordVOIPService) Join(guildId string, channelId string) error {
+	if d.voiceConnection != nil {
+		return errors.New("already joined a voice channel")
+	}
+	voice, err := d.session.ChannelVoiceJoin(guildId, channelId, false, false)
+	if err != nil {
+		return err
+	}
+	d.voiceConnection = voice
+	d.guildId = guildId
+	d.channelId = channelId
+	d.leave = make(chan bool)
+	d.connectedMutex.Lock()
+	d.connected = make(map[string]bool)
+	d.connectedMutex.Unlock()
+	d.disconnectHandler()
+	d.connectHandler()
+	go d.forwardOpusRecv(voice.OpusRecv, d.leave)
+	return nil
+}
+
+func (d *DiscordVOIPService) Leave() error {
+	if d.voiceConnection == nil {
+		return nil
+	}
+	for _, removeHandler := range d.removeHandlers {
+		removeHandler()
+	}
+	d.removeHandlers = nil
+	close(d.leave)
+	err := d.voiceConnection.Disconnect()
+	d.voiceConnection.Close()
+	d.voiceConnection = nil
+	return err
+}
+
+//Close only leaves the voice channel since the session is shared, DiscordSession.Close disconnects
+func (d *DiscordVOIPService) Close() error {
+	return d.Leave()
+}
+
+func (d *DiscordVOIPService) OpusRecv() <-chan *VoicePacket {
+	return d.opusRecv
+}
+
+//nil until joined so anything sent before joining will block
+func (d *DiscordVOIPService) OpusSend() chan<- []byte {
+	if d.voiceConnection == nil {
+		return nil
+	}
+	return d.voiceConnection.OpusSend
+}
+
+func (d *DiscordVOIPService) Speaking(speaking bool) error {
+	if d.voiceConnection == nil {
+		return errors.New("not joined to a voice channel")
+	}
+	return d.voiceConnection.Speaking(speaking)
+}
+
+func (d *DiscordVOIPService) SpeakerConnect() <-chan Speaker {
+	return d.speakerConnect
+}
+
+func (d *DiscordVOIPService) SpeakerDisconnect() <-chan string {
+	return d.speakerDisconnect
+}
+
+func (d *DiscordVOIPService) User(userId string) (*VOIPUser, error) {
+	user, err := d.session.User(userId)
+	if err != nil {
+		return nil, err
+	}
+	member, err := d.session.State.Member(d.guildId, userId)
+	if err != nil {
+		member, err = d.session.GuildMember(d.guildId, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &VOIPUser{Id: user.ID, Username: user.Username, Bot: user.Bot, Roles: member.Roles}, nil
+}
+
+//discord packets are copied into voice packets so nothing outside this file depends on discordgo
+func (d *DiscordVOIPService) forwardOpusRecv(opusRecv <-chan *discordgo.Packet, leave <-chan bool) {
+	for {
+		select {
+		case packet, ok := <-opusRecv:
+			if !ok {
+				return
+			}
+			select {
+			case d.opusRecv <- &VoicePacket{SSRC: packet.SSRC, Opus: packet.Opus}:
+			case <-leave:
+				return
+			}
+		case <-leave:
+			return
+		}
+	}
+}
+
+//voice state updates come from every guild on the session so only users leaving this channel count,
+//moving to another channel is the same as leaving. updates like muting from users in other channels
+//are ignored since they were never connected here
+func (d *DiscordVOIPService) disconnectHandler() {
+	leave := d.leave
+	removeHandler := d.session.AddHandler(func(session *discordgo.Session, state *discordgo.VoiceStateUpdate) {
+		if state.GuildID != d.guildId || state.ChannelID == d.channelId {
+			return
+		}
+		d.connectedMutex.Lock()
+		connected := d.connected[state.UserID]
+		delete(d.connected, state.UserID)
+		d.connectedMutex.Unlock()
+		if !connected {
+			return
+		}
+		select {
+		case d.speakerDisconnect <- state.UserID:
+		case <-leave:
+		}
+	})
+	d.removeHandlers = append(d.removeHandlers, removeHandler)
+}
+
+//voice connections have no way to remove a handler so it stops sending once left instead. the voice
+//connection is dropped when leaving so a handler never outlives it
+func (d *DiscordVOIPService) connectHandler() {
+	leave := d.leave
+	d.voiceConnection.AddHandler(func(vc *discordgo.VoiceConnection, vs *discordgo.VoiceSpeakingUpdate) {
+		d.connectedMutex.Lock()
+		d.connected[vs.UserID] = true
+		d.connectedMutex.Unlock()
+		select {
+		case d.speakerConnect <- Speaker{
+			SSRC:   uint32(vs.SSRC),
+			UserId: vs.UserID,
+		}:
+		case <-leave:
+		}
+	})
+}
+
+func logDiscord(msgL int, caller int, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	switch msgL {
+	case discordgo.LogError:
+		zap.S().Error(message)
+	case discordgo.LogWarning:
+		zap.S().Warn(message)
+	case discordgo.LogInformational:
+		zap.S().Info(message)
+	default:
+		zap.S().Debug(message)
+	}
+}
@@ -0,0 +1,184 @@
+package VoiceRecognition
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//FakeVOIPService is an in memory voip service for running the pipeline without discord.
+//scripted speakers are injected with AddSpeaker and SpeakWave and everything the bot
+//plays back is captured as clips, one clip per Speaking(true) to Speaking(false).
+type FakeVOIPService struct {
+	//FrameInterval paces injected packets like a real connection would. zero sends them as fast as they are read
+	FrameInterval time.Duration
+	//PlaybackInterval paces played frames so playback can be interrupted. zero captures them as fast as they are sent
+	PlaybackInterval  time.Duration
+	opusRecv          chan *VoicePacket
+	opusSend          chan []byte
+	speakerConnect    chan Speaker
+	speakerDisconnect chan string
+	mutex             sync.Mutex
+	users             map[string]*VOIPUser
+	joined            bool
+	currentClip       [][]byte
+	clips             [][][]byte
+}
+
+func CreateFakeVOIPService() *FakeVOIPService {
+	f := &FakeVOIPService{
+		opusRecv:          make(chan *VoicePacket),
+		opusSend:          make(chan []byte),
+		speakerConnect:    make(chan Speaker),
+		speakerDisconnect: make(chan string),
+		users:             make(map[string]*VOIPUser),
+	}
+	go f.capturePlayback()
+	return f
+}
+
+func (f *FakeVOIPService) Join(guildId string, channelId string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.joined {
+		return errors.New("already joined a voice channel")
+	}
+	f.joined = true
+	return nil
+}
+
+func (f *FakeVOIPService) Leave() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.joined = false
+	return nil
+}
+
+func (f *FakeVOIPService) Close() error {
+	return f.Leave()
+}
+
+//Joined is true between Join and Leave
+func (f *FakeVOIPService) Joined() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.joined
+}
+
+func (f *FakeVOIPService) OpusRecv() <-chan *VoicePacket {
+	return f.opusRecv
+}
+
+func (f *FakeVOIPService) OpusSend() chan<- []byte {
+	return f.opusSend
+}
+
+//a nil frame is pushed through the send channel when speaking stops so the end of a clip
+//is captured in order with the frames sent before it
+func (f *FakeVOIPService) Speaking(speaking bool) error {
+	if !speaking {
+		f.opusSend <- nil
+	}
+	return nil
+}
+
+func (f *FakeVOIPService) SpeakerConnect() <-chan Speaker {
+	return f.speakerConnect
+}
+
+func (f *FakeVOIPService) SpeakerDisconnect() <-chan string {
+	return f.speakerDisconnect
+}
+
+func (f *FakeVOIPService) User(userId string) (*VOIPUser, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	user, exists := f.users[userId]
+	if !exists {
+		return nil, fmt.Errorf("unknown user %s", userId)
+	}
+	return user, nil
+}
+
+//AddSpeaker registers the user and announces their ssrc like discord does when they first speak
+func (f *FakeVOIPService) AddSpeaker(ssrc uint32, user VOIPUser) {
+	f.mutex.Lock()
+	f.users[user.Id] = &user
+	f.mutex.Unlock()
+	f.speakerConnect <- Speaker{SSRC: ssrc, UserId: user.Id}
+}
+
+func (f *FakeVOIPService) RemoveSpeaker(userId string) {
+	f.speakerDisconnect <- userId
+}
+
+//SpeakWave encodes the wave file to opus and sends it as the speaker followed by the silence
+//packets discord sends when a user stops talking
+func (f *FakeVOIPService) SpeakWave(ssrc uint32, wave []byte) error {
+	opusFrames, err := waveToOpusFrames(wave)
+	if err != nil {
+		return err
+	}
+	f.SpeakOpus(ssrc, opusFrames)
+	return nil
+}
+
+func (f *FakeVOIPService) SpeakOpus(ssrc uint32, opusFrames [][]byte) {
+	for _, opusFrame := range opusFrames {
+		f.sendPacket(ssrc, opusFrame)
+	}
+	f.SpeakSilence(ssrc, 10)
+}
+
+func (f *FakeVOIPService) SpeakSilence(ssrc uint32, frames int) {
+	for i := 0; i < frames; i++ {
+		f.sendPacket(ssrc, opusSilence)
+	}
+}
+
+func (f *FakeVOIPService) sendPacket(ssrc uint32, opusFrame []byte) {
+	f.opusRecv <- &VoicePacket{SSRC: ssrc, Opus: opusFrame}
+	if f.FrameInterval > 0 {
+		time.Sleep(f.FrameInterval)
+	}
+}
+
+//Clips returns every clip the bot has finished playing so far
+func (f *FakeVOIPService) Clips() [][][]byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	clips := make([][][]byte, len(f.clips))
+	copy(clips, f.clips)
+	return clips
+}
+
+//WaitForClip blocks until a played clip matches or the timeout passes
+func (f *FakeVOIPService) WaitForClip(matches func(clip [][]byte) bool, timeout time.Duration) ([][]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, clip := range f.Clips() {
+			if matches(clip) {
+				return clip, nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, errors.New("timed out waiting for clip to be played")
+}
+
+func (f *FakeVOIPService) capturePlayback() {
+	for opusFrame := range f.opusSend {
+		f.mutex.Lock()
+		if opusFrame == nil {
+			f.clips = append(f.clips, f.currentClip)
+			f.currentClip = nil
+		} else {
+			f.currentClip = append(f.currentClip, opusFrame)
+		}
+		f.mutex.Unlock()
+		if opusFrame != nil && f.PlaybackInterval > 0 {
+			time.Sleep(f.PlaybackInterval)
+		}
+	}
+}
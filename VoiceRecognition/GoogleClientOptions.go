@@ -0,0 +1,28 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+//GoogleClientOptions gives the speech and text to speech clients the configured credentials file and
+//points them at the configured endpoint. without an endpoint the clients use google as normal
+func GoogleClientOptions(config Config.Config) []option.ClientOption {
+	var options []option.ClientOption
+	if config.GoogleServices.Endpoint != "" {
+		options = append(options, option.WithEndpoint(config.GoogleServices.Endpoint))
+	}
+	if config.GoogleServices.Endpoint != "" && config.GoogleServices.Insecure {
+		return append(options,
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		)
+	}
+	//without a file the clients fall back to GOOGLE_APPLICATION_CREDENTIALS and the default credentials
+	if config.GoogleServices.CredentialsFile != "" {
+		options = append(options, option.WithCredentialsFile(config.GoogleServices.CredentialsFile))
+	}
+	return options
+}
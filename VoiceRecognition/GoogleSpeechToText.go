@@ -0,0 +1,128 @@
+package VoiceRecognition
+
+import (
+	speech "cloud.google.com/go/speech/apiv1"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"io"
+)
+
+type GoogleSpeechToText struct {
+	//defaults to en-GB
+	LanguageCode string
+	//ClientOptions can point the client somewhere other than google
+	ClientOptions []option.ClientOption
+}
+
+type googleSpeechToTextStream struct {
+	client                   *speech.Client
+	streamingRecognizeClient speechpb.Speech_StreamingRecognizeClient
+	transcripts              chan Transcript
+	err                      error
+}
+
+func (g *GoogleSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	languageCode := g.LanguageCode
+	if languageCode == "" {
+		languageCode = "en-GB"
+	}
+	client, err := speech.NewClient(ctx, g.ClientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.StreamingRecognize(ctx)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if err := stream.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
+			StreamingConfig: &speechpb.StreamingRecognitionConfig{
+				Config: &speechpb.RecognitionConfig{
+					Encoding:        speechpb.RecognitionConfig_LINEAR16,
+					SampleRateHertz: discordSampleRate,
+					LanguageCode:    languageCode,
+				},
+				SingleUtterance: true,
+				InterimResults:  true,
+			},
+		},
+	}); err != nil {
+		client.Close()
+		return nil, err
+	}
+	gs := &googleSpeechToTextStream{
+		client:                   client,
+		streamingRecognizeClient: stream,
+		transcripts:              make(chan Transcript, 10),
+	}
+	go gs.readResponse()
+	return gs, nil
+}
+
+func (gs *googleSpeechToTextStream) SendPCM(pcm []int16) error {
+	//could mabye use a two channel configuration for google speech recognition removing the need to convert to mono
+	pcmMono := convertPCMToMono(pcm)
+	pcmBytes, err := int16SliceToByteSlice(pcmMono)
+	if err != nil {
+		return err
+	}
+	return gs.streamingRecognizeClient.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+			AudioContent: pcmBytes,
+		},
+	})
+}
+
+func (gs *googleSpeechToTextStream) Transcripts() <-chan Transcript {
+	return gs.transcripts
+}
+
+func (gs *googleSpeechToTextStream) Err() error {
+	return gs.err
+}
+
+func (gs *googleSpeechToTextStream) Close() error {
+	return gs.streamingRecognizeClient.CloseSend()
+}
+
+func (gs *googleSpeechToTextStream) readResponse() {
+	defer close(gs.transcripts)
+	defer func() {
+		if err := gs.client.Close(); err != nil {
+			zap.S().Infof("Could not close client: %v", err)
+		}
+	}()
+	for {
+		resp, err := gs.streamingRecognizeClient.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			gs.err = fmt.Errorf("cannot stream results: %v", err)
+			return
+		}
+		if err := resp.Error; err != nil {
+			// Workaround while the API doesn't give a more informative error.
+			if err.Code == 3 || err.Code == 11 {
+				zap.S().Info("WARNING: Speech recognition request exceeded limit of 60 seconds.")
+			}
+			gs.err = fmt.Errorf("could not recognize: %v", err)
+			return
+		}
+		for _, result := range resp.Results {
+			if len(result.Alternatives) == 0 {
+				continue
+			}
+			gs.transcripts <- Transcript{
+				Text:       result.Alternatives[0].Transcript,
+				Final:      result.IsFinal,
+				Confidence: result.Alternatives[0].Confidence,
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/GoogleStandIn"
+	"DiscordVoiceRecognition/RasaNLU"
+	"context"
+	"encoding/json"
+	"fmt"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func startStandIn(t *testing.T) (*GoogleStandIn.StandIn, Config.Config) {
+	standIn, err := GoogleStandIn.CreateStandIn("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(standIn.Close)
+	var config Config.Config
+	config.GoogleServices.Endpoint = standIn.Address()
+	config.GoogleServices.Insecure = true
+	return standIn, config
+}
+
+//runs command recognition against the stand in and returns what it notified
+func recogniseCommand(t *testing.T, script GoogleStandIn.RecognizeScript) (CommandSpokenNotify, *GoogleStandIn.StandIn) {
+	standIn, config := startStandIn(t)
+	standIn.ScriptRecognize(script)
+	speechToText, err := CreateSpeechToText(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandNotify := make(chan CommandSpokenNotify)
+	commandRecognition, err := createCommandRecognition(1, commandNotify, speechToText, defaultSessionTimeouts[Listening])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandRecognition.Close()
+	select {
+	case commandSpoken := <-commandNotify:
+		return commandSpoken, standIn
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never notified")
+	}
+	return CommandSpokenNotify{}, standIn
+}
+
+func TestGoogleCommandTranscript(t *testing.T) {
+	commandSpoken, standIn := recogniseCommand(t, GoogleStandIn.RecognizeScript{
+		Responses: []*speechpb.StreamingRecognizeResponse{
+			GoogleStandIn.TranscriptResponse("play", false, 0),
+			GoogleStandIn.TranscriptResponse("play air horn", true, 0.9),
+		},
+		WaitForClose: true,
+	})
+	if commandSpoken.command != "play air horn" || commandSpoken.confidence != 0.9 {
+		t.Errorf("expected command \"play air horn\" with confidence 0.9 got \"%s\" with %f", commandSpoken.command, commandSpoken.confidence)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(standIn.Recognitions()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recognitions := standIn.Recognitions()
+	if len(recognitions) != 1 {
+		t.Fatalf("expected 1 recognition got %d", len(recognitions))
+	}
+	recognitionConfig := recognitions[0].Config.GetConfig()
+	if recognitionConfig.GetLanguageCode() != "en-GB" || recognitionConfig.GetSampleRateHertz() != discordSampleRate {
+		t.Errorf("unexpected recognition config %+v", recognitionConfig)
+	}
+	if len(recognitions[0].Audio) == 0 {
+		t.Error("no audio was sent")
+	}
+}
+
+func TestGoogleCommandFailures(t *testing.T) {
+	scripts := map[string]GoogleStandIn.RecognizeScript{
+		"exceeded limit": {Responses: []*speechpb.StreamingRecognizeResponse{
+			GoogleStandIn.TranscriptResponse("play", false, 0),
+			GoogleStandIn.ErrorResponse(codes.OutOfRange, "Exceeded maximum allowed stream duration of 65 seconds."),
+		}},
+		"invalid argument": {Responses: []*speechpb.StreamingRecognizeResponse{
+			GoogleStandIn.ErrorResponse(codes.InvalidArgument, "Audio Timeout Error: Long duration elapsed without audio."),
+		}},
+		"eof":           {},
+		"empty results": {Responses: []*speechpb.StreamingRecognizeResponse{{}, {Results: []*speechpb.StreamingRecognitionResult{{IsFinal: true}}}}},
+		"stream error":  {Err: status.Error(codes.Unavailable, "the service is currently unavailable")},
+	}
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			commandSpoken, _ := recogniseCommand(t, script)
+			if commandSpoken.command != "" {
+				t.Errorf("expected no command got \"%s\"", commandSpoken.command)
+			}
+		})
+	}
+}
+
+func TestGoogleTextToSpeech(t *testing.T) {
+	standIn, config := startStandIn(t)
+	standIn.ScriptSynthesize(GoogleStandIn.SynthesizeScript{AudioContent: []byte("RIFF")})
+	textToSpeech, err := CreateTextToSpeech(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := textToSpeech.Synthesize(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(audio) != "RIFF" {
+		t.Errorf("unexpected audio %v", audio)
+	}
+	requests := standIn.SynthesizeRequests()
+	if len(requests) != 1 || requests[0].GetInput().GetText() != "hello" || requests[0].GetVoice().Name != "en-GB-Wavenet-A" {
+		t.Errorf("unexpected synthesize requests %+v", requests)
+	}
+
+	if _, err := textToSpeech.Synthesize(context.Background(), "hello again"); err == nil {
+		t.Error("expected an error when google is unavailable")
+	}
+}
+
+//rasa and the remote bot are the only other services a spoken command goes to so they are stood in
+//for over http. the shared config points at them since command processing reads it
+func useCommandServices(t *testing.T, intent string, response string) <-chan UserCommand {
+	rasa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(RasaNLU.ParserResponse{Intent: RasaNLU.Intent{Name: intent, Confidence: 0.9}})
+	}))
+	t.Cleanup(rasa.Close)
+	userCommands := make(chan UserCommand, 10)
+	remoteBot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userCommand UserCommand
+		if err := json.NewDecoder(r.Body).Decode(&userCommand); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userCommands <- userCommand
+		json.NewEncoder(w).Encode(RemoteBotResponse{Text: response, Understood: true})
+	}))
+	t.Cleanup(remoteBot.Close)
+	rasaURL, err := url.Parse(rasa.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	contents := fmt.Sprintf("rasa:\n  scheme: http\n  host: %s\n  port: \"%s\"\nremotebot:\n  address: %s\n", rasaURL.Hostname(), rasaURL.Port(), remoteBot.URL)
+	if err := ioutil.WriteFile(configPath, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Config.SetPath(configPath)
+	t.Cleanup(func() {
+		Config.SetPath("")
+	})
+	return userCommands
+}
+
+func TestGooglePipeline(t *testing.T) {
+	standIn, config := startStandIn(t)
+	standIn.ScriptRecognize(GoogleStandIn.RecognizeScript{
+		Responses: []*speechpb.StreamingRecognizeResponse{
+			GoogleStandIn.TranscriptResponse("play air horn", true, 0.9),
+		},
+		WaitForClose: true,
+	})
+	response := toneWave(660, 500*time.Millisecond)
+	standIn.ScriptSynthesize(GoogleStandIn.SynthesizeScript{AudioContent: response})
+	userCommands := useCommandServices(t, "playhorn", "playing air horn")
+	//sphinx isn't available so only the key phrase is scripted
+	soundsPath = "Sounds/"
+	newKeyPhraseRecognition = scriptedKeyPhraseRecognition(nil, "hey lydia")
+	t.Cleanup(func() {
+		soundsPath = "VoiceRecognition/Sounds/"
+		newKeyPhraseRecognition = createKeyPhraseRecognition
+	})
+	speechToText, err := CreateSpeechToText(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textToSpeech, err := CreateTextToSpeech(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voip := CreateFakeVOIPService()
+	cvr := CreateChannelVoiceRecognitionController(voip, speechToText, textToSpeech, testConfig(1), "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	if err := voip.SpeakWave(1, toneWave(440, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := voip.WaitForClip(clipMatching(t, readSound(t, "Listening.wav")), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := voip.SpeakWave(1, toneWave(440, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case userCommand := <-userCommands:
+		if userCommand.UserId != "user1" || userCommand.Intent.Name != "playhorn" {
+			t.Errorf("unexpected command %+v", userCommand)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command never reached the remote bot")
+	}
+	if _, err := voip.WaitForClip(clipMatching(t, response), 5*time.Second); err != nil {
+		t.Error(err)
+	}
+	requests := standIn.SynthesizeRequests()
+	if len(requests) != 1 || requests[0].GetInput().GetText() != "playing air horn" {
+		t.Errorf("unexpected synthesize requests %+v", requests)
+	}
+}
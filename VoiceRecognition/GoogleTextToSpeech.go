@@ -0,0 +1,75 @@
+package VoiceRecognition
+
+import (
+	texttospeech "cloud.google.com/go/texttospeech/apiv1"
+	"context"
+	"google.golang.org/api/option"
+	texttospeechpb "google.golang.org/genproto/googleapis/cloud/texttospeech/v1"
+	"sync"
+)
+
+type GoogleTextToSpeech struct {
+	//defaults to en-GB
+	LanguageCode string
+	//Voice is a google voice name, defaults to en-GB-Wavenet-A
+	Voice string
+	//ClientOptions can point the client somewhere other than google
+	ClientOptions []option.ClientOption
+	client        *texttospeech.Client
+	clientMutex   sync.Mutex
+}
+
+func (g *GoogleTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	languageCode := g.LanguageCode
+	if languageCode == "" {
+		languageCode = "en-GB"
+	}
+	voice := g.Voice
+	gender := texttospeechpb.SsmlVoiceGender_SSML_VOICE_GENDER_UNSPECIFIED
+	if voice == "" {
+		voice = "en-GB-Wavenet-A"
+		gender = texttospeechpb.SsmlVoiceGender_FEMALE
+	}
+
+	client, err := g.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req := texttospeechpb.SynthesizeSpeechRequest{
+		Input: &texttospeechpb.SynthesisInput{
+			InputSource: &texttospeechpb.SynthesisInput_Text{Text: text},
+		},
+
+		Voice: &texttospeechpb.VoiceSelectionParams{
+			LanguageCode: languageCode,
+			Name:         voice,
+			SsmlGender:   gender,
+		},
+		AudioConfig: &texttospeechpb.AudioConfig{
+			AudioEncoding:   texttospeechpb.AudioEncoding_LINEAR16,
+			SampleRateHertz: discordSampleRate,
+		},
+	}
+
+	resp, err := client.SynthesizeSpeech(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.AudioContent, nil
+}
+
+//the client is kept between responses instead of connecting to google every time
+func (g *GoogleTextToSpeech) getClient() (*texttospeech.Client, error) {
+	g.clientMutex.Lock()
+	defer g.clientMutex.Unlock()
+	if g.client != nil {
+		return g.client, nil
+	}
+	client, err := texttospeech.NewClient(context.Background(), g.ClientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	g.client = client
+	return client, nil
+}
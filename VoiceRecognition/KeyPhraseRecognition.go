@@ -3,7 +3,6 @@ package VoiceRecognition
 import (
 	"DiscordVoiceRecognition/Config"
 	"bytes"
-	"github.com/bwmarrin/discordgo"
 	"github.com/xlab/pocketsphinx-go/sphinx"
 	"github.com/zaf/resample"
 	"go.uber.org/zap"
@@ -69,9 +68,11 @@ func createKeyPhraseRecognition(keywordSpokenNotify chan KeywordSpokenNotify) (*
 }
 
 //need second utterance check while listening to users voice command to check for keyword again to reset
-//listening for canceling is also needed
+//cancel phrases are spotted the same way as the key phrase, the controller works out what they mean
 func (kr *KeyPhraseRecognition) start() {
 	go func() {
+		//the decoder is c memory so it has to be freed once the user is gone or it is replaced
+		defer kr.sphinxListener.dec.Destroy()
 		for {
 			voiceInfo, ok := <-kr.VoiceInfoRecv
 			if !ok {
@@ -117,7 +118,7 @@ func (kr *KeyPhraseRecognition) fillBufferForDownsample() {
 	}
 }
 
-func (kr *KeyPhraseRecognition) decode(packet *discordgo.Packet) error {
+func (kr *KeyPhraseRecognition) decode(packet *VoicePacket) error {
 	pcmOrig := make([]int16, frameSizeStereo)
 
 	_, err := kr.opusDecoder.Decode(packet.Opus, pcmOrig)
@@ -168,6 +169,10 @@ func (kr *KeyPhraseRecognition) keyPhraseListing() (string, error) {
 }
 
 func resamplePCM(pcm []int16) ([]int16, error) {
+	return resamplePCMRate(pcm, 2, discordSampleRate, sphinxSampleRate)
+}
+
+func resamplePCMRate(pcm []int16, channels int, fromSampleRate int, toSampleRate int) ([]int16, error) {
 	//should figure out a way to reuse the sampler will probably speed things up
 	pcmBytes, err := int16SliceToByteSlice(pcm)
 	if err != nil {
@@ -175,11 +180,11 @@ func resamplePCM(pcm []int16) ([]int16, error) {
 	}
 	var resampledPCMBytes bytes.Buffer
 	resampledBytesWriter := io.Writer(&resampledPCMBytes)
-	res, err := resample.New(resampledBytesWriter, float64(discordSampleRate), float64(sphinxSampleRate), 2, resample.I16, resample.HighQ)
-	defer res.Close()
+	res, err := resample.New(resampledBytesWriter, float64(fromSampleRate), float64(toSampleRate), channels, resample.I16, resample.HighQ)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Close()
 	_, err = res.Write(pcmBytes)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,111 @@
+package VoiceRecognition
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//piper models are trained at this rate unless their config says otherwise
+const piperDefaultSampleRate = 22050
+
+//EspeakTextToSpeech reads out responses with espeak-ng. it sounds robotic but needs no model
+//or cloud account
+type EspeakTextToSpeech struct {
+	//Command defaults to espeak-ng
+	Command string
+	//Voice is an espeak voice like en-gb, the espeak default is used if empty
+	Voice string
+}
+
+//PiperTextToSpeech reads out responses with a piper onnx voice model
+type PiperTextToSpeech struct {
+	//Command defaults to piper
+	Command string
+	//Model is the .onnx voice. its .onnx.json config is read for the sample rate
+	Model string
+}
+
+func (e *EspeakTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	command := e.Command
+	if command == "" {
+		command = "espeak-ng"
+	}
+	args := []string{"--stdout", "--stdin"}
+	if e.Voice != "" {
+		args = append(args, "-v", e.Voice)
+	}
+	output, err := runTextToSpeechCommand(ctx, command, args, text)
+	if err != nil {
+		return nil, err
+	}
+	speech, err := decodeWave(output)
+	if err != nil {
+		return nil, err
+	}
+	return discordWave(speech)
+}
+
+func (p *PiperTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	command := p.Command
+	if command == "" {
+		command = "piper"
+	}
+	if p.Model == "" {
+		return nil, errors.New("piper needs a model")
+	}
+	sampleRate, err := piperSampleRate(p.Model)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runTextToSpeechCommand(ctx, command, []string{"--model", p.Model, "--output_raw"}, text)
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := byteSliceToInt16Slice(output[:len(output)-len(output)%2])
+	if err != nil {
+		return nil, err
+	}
+	return discordWave(&Wave{SampleRate: sampleRate, Channels: 1, PCM: pcm})
+}
+
+//the text goes in on stdin so a response starting with - isn't taken as a flag
+func runTextToSpeechCommand(ctx context.Context, command string, args []string, text string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func piperSampleRate(model string) (int, error) {
+	modelConfig, err := ioutil.ReadFile(model + ".json")
+	if os.IsNotExist(err) {
+		return piperDefaultSampleRate, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var voice struct {
+		Audio struct {
+			SampleRate int `json:"sample_rate"`
+		} `json:"audio"`
+	}
+	if err := json.Unmarshal(modelConfig, &voice); err != nil {
+		return 0, fmt.Errorf("could not read piper model config: %v", err)
+	}
+	if voice.Audio.SampleRate == 0 {
+		return piperDefaultSampleRate, nil
+	}
+	return voice.Audio.SampleRate, nil
+}
@@ -0,0 +1,97 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//writes a script that saves the text it is given and prints output like espeak or piper would
+func fakeTextToSpeechCommand(t *testing.T, output []byte) (string, string) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output")
+	textPath := filepath.Join(dir, "text")
+	if err := ioutil.WriteFile(outputPath, output, 0644); err != nil {
+		t.Fatal(err)
+	}
+	command := filepath.Join(dir, "tts")
+	script := "#!/bin/sh\ncat > " + textPath + "\ncat " + outputPath + "\n"
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return command, textPath
+}
+
+func checkDiscordWave(t *testing.T, wave []byte, duration time.Duration) {
+	speech, err := decodeWave(wave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if speech.SampleRate != discordSampleRate || speech.Channels != 2 {
+		t.Errorf("expected 48khz stereo got %dhz with %d channels", speech.SampleRate, speech.Channels)
+	}
+	//resampling can add or drop a few samples
+	expected := int(duration.Seconds() * discordSampleRate * 2)
+	if len(speech.PCM) < expected-frameSizeStereo || len(speech.PCM) > expected+frameSizeStereo {
+		t.Errorf("expected around %d samples got %d", expected, len(speech.PCM))
+	}
+}
+
+func TestEspeakTextToSpeech(t *testing.T) {
+	wave := toneWave(440, time.Second)
+	//espeak can't seek back over stdout so the sizes are left at the maximum
+	binary.LittleEndian.PutUint32(wave[4:8], 0x7fffffff)
+	binary.LittleEndian.PutUint32(wave[40:44], 0x7fffffff)
+	command, textPath := fakeTextToSpeechCommand(t, wave)
+
+	espeak := &EspeakTextToSpeech{Command: command, Voice: "en-gb"}
+	output, err := espeak.Synthesize(context.Background(), "-hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscordWave(t, output, time.Second)
+	if text, _ := ioutil.ReadFile(textPath); string(text) != "-hello" {
+		t.Errorf("expected the text on stdin got \"%s\"", text)
+	}
+}
+
+func TestEspeakVoiceFromConfig(t *testing.T) {
+	var config Config.Config
+	config.TextToSpeech.Provider = "espeak"
+	config.TextToSpeech.Google.Voice = "en-GB-Wavenet-A"
+	config.TextToSpeech.Espeak.Voice = "en-gb"
+	textToSpeech, err := CreateTextToSpeech(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if espeak, ok := textToSpeech.(*EspeakTextToSpeech); !ok || espeak.Voice != "en-gb" {
+		t.Errorf("expected espeak to use its own voice not the google one got %+v", textToSpeech)
+	}
+}
+
+func TestPiperTextToSpeech(t *testing.T) {
+	speech, err := decodeWave(toneWave(440, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := int16SliceToByteSlice(speech.PCM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, _ := fakeTextToSpeechCommand(t, raw)
+	model := filepath.Join(t.TempDir(), "voice.onnx")
+	if err := ioutil.WriteFile(model+".json", []byte(`{"audio": {"sample_rate": 16000}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	piper := &PiperTextToSpeech{Command: command, Model: model}
+	output, err := piper.Synthesize(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDiscordWave(t, output, time.Second)
+}
@@ -0,0 +1,183 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"fmt"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+//permissionDeniedResponse is read out instead of going to the remote bot
+const permissionDeniedResponse = "sorry you don't have permission to do that"
+
+type PermissionAction string
+
+const (
+	//PermissionAllow lets a role or user use an intent or remote bot, everyone else can't anymore
+	PermissionAllow PermissionAction = "allow"
+	//PermissionRevoke undoes PermissionAllow, revoking the last role or user leaves nobody able to use it
+	PermissionRevoke PermissionAction = "revoke"
+	//PermissionOpen lets everyone use an intent or remote bot again
+	PermissionOpen PermissionAction = "open"
+	//PermissionList shows who can use what
+	PermissionList PermissionAction = "list"
+)
+
+//PermissionRequest is a user changing who can use intents and remote bots in their guild
+type PermissionRequest struct {
+	Action PermissionAction
+	//GuildId is the guild the command was run in, only its permissions are changed or listed
+	GuildId string
+	//Intent or RemoteBot is what the permission is for, neither is set to list
+	Intent    string
+	RemoteBot string
+	//RoleId or UserId is who the permission is for
+	RoleId string
+	UserId string
+	//RequestedBy is the user changing permissions
+	RequestedBy string
+	//Reply tells the user what happened
+	Reply func(message string)
+}
+
+//ManagePermissions changes the requesting guilds permissions in the permissions file for each request.
+//the config watcher picks up the change so nothing else needs telling. it runs until requests is closed
+func ManagePermissions(requests <-chan PermissionRequest) {
+	for request := range requests {
+		config := Config.LoadConfig()
+		if request.Action == PermissionList {
+			request.Reply(describePermissions(config.GuildPermissions(request.GuildId)))
+			continue
+		}
+		if (request.Intent == "") == (request.RemoteBot == "") {
+			request.Reply("Give an intent or a remote bot")
+			continue
+		}
+		if request.Action != PermissionOpen && (request.RoleId == "") == (request.UserId == "") {
+			request.Reply("Give an intent or a remote bot, and a role or a user")
+			continue
+		}
+		//a bad address would stop the config reloading so only the ones in use can be given
+		if request.RemoteBot != "" && !remoteBotConfigured(config, request.GuildId, request.RemoteBot) {
+			request.Reply(fmt.Sprintf("%s isn't a remote bot in the config", request.RemoteBot))
+			continue
+		}
+		file, err := Config.ReadPermissionsFile(config.Permissions.File)
+		if err != nil {
+			zap.S().Warn(err)
+			request.Reply("I couldn't read the permissions")
+			continue
+		}
+		permissions := file.Guild(request.GuildId)
+		target := permissionTarget(request.Intent, request.RemoteBot)
+		grantee := permissionGrantee(request.RoleId, request.UserId)
+		var reply string
+		switch request.Action {
+		case PermissionAllow:
+			permissions.Allow(request.Intent, request.RemoteBot, request.RoleId, request.UserId)
+			reply = fmt.Sprintf("Allowed %s to use %s", grantee, target)
+		case PermissionRevoke:
+			if !permissions.Revoke(request.Intent, request.RemoteBot, request.RoleId, request.UserId) {
+				//permissions in the config itself can't be revoked from discord
+				request.Reply(fmt.Sprintf("%s wasn't allowed to use %s with /%s", grantee, target, commandName))
+				continue
+			}
+			reply = fmt.Sprintf("Revoked %s from using %s", grantee, target)
+			if permission, _ := permissionFor(*permissions, request.Intent, request.RemoteBot); len(permission.Roles)+len(permission.Users) == 0 {
+				reply += fmt.Sprintf(", nobody else was allowed so it can't be used until /%s %s %s", commandName, permissionsGroup, PermissionOpen)
+			}
+		case PermissionOpen:
+			if !permissions.Open(request.Intent, request.RemoteBot) {
+				request.Reply(fmt.Sprintf("%s wasn't limited with /%s", target, commandName))
+				continue
+			}
+			reply = fmt.Sprintf("Everyone can use %s", target)
+			//the permissions file is added to the config so the config can still limit it
+			if _, limited := permissionFor(config.Permissions.Guilds[request.GuildId], request.Intent, request.RemoteBot); limited {
+				reply = fmt.Sprintf("Removed the permissions for %s given with /%s, the config still limits it", target, commandName)
+			}
+		default:
+			continue
+		}
+		if err := Config.WritePermissionsFile(config.Permissions.File, file); err != nil {
+			zap.S().Warnf("Failed to write permissions to %s: %s", config.Permissions.File, err)
+			request.Reply("I couldn't save the permissions")
+			continue
+		}
+		zap.S().Infof("user %s changed permissions in guild %s: %s", request.RequestedBy, request.GuildId, reply)
+		request.Reply(reply)
+	}
+}
+
+//only the remote bots the guild can reach are offered so guilds can't see each others
+func remoteBotConfigured(config Config.Config, guildId string, remoteBot string) bool {
+	if config.RemoteBot.Address == remoteBot {
+		return true
+	}
+	for _, channel := range config.DiscordChannels() {
+		if channel.Guild == guildId && channel.RemoteBot == remoteBot {
+			return true
+		}
+	}
+	return false
+}
+
+//permissionFor is the permission for the intent or remote bot, it is false if they aren't limited
+func permissionFor(permissions Config.Permissions, intent string, remoteBot string) (Config.Permission, bool) {
+	if remoteBot != "" {
+		permission, limited := permissions.RemoteBots[remoteBot]
+		return permission, limited
+	}
+	permission, limited := permissions.Intents[intent]
+	return permission, limited
+}
+
+func permissionTarget(intent string, remoteBot string) string {
+	if remoteBot != "" {
+		return "remote bot " + remoteBot
+	}
+	return "intent " + intent
+}
+
+//grantees are mentions so discord shows their names
+func permissionGrantee(roleId string, userId string) string {
+	if roleId != "" {
+		return "<@&" + roleId + ">"
+	}
+	return "<@" + userId + ">"
+}
+
+func describePermissions(permissions Config.Permissions) string {
+	var lines []string
+	for _, targets := range []struct {
+		remoteBot   bool
+		permissions map[string]Config.Permission
+	}{
+		{false, permissions.Intents},
+		{true, permissions.RemoteBots},
+	} {
+		for name, permission := range targets.permissions {
+			var grantees []string
+			for _, role := range permission.Roles {
+				grantees = append(grantees, permissionGrantee(role, ""))
+			}
+			for _, user := range permission.Users {
+				grantees = append(grantees, permissionGrantee("", user))
+			}
+			target := permissionTarget(name, "")
+			if targets.remoteBot {
+				target = permissionTarget("", name)
+			}
+			if len(grantees) == 0 {
+				grantees = append(grantees, "nobody")
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s", target, strings.Join(grantees, " ")))
+		}
+	}
+	if len(lines) == 0 {
+		return "Everyone can use everything"
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
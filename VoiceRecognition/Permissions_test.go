@@ -0,0 +1,20 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"testing"
+)
+
+func TestDescribePermissions(t *testing.T) {
+	if description := describePermissions(Config.Permissions{}); description != "Everyone can use everything" {
+		t.Errorf("expected no permissions to say so got %q", description)
+	}
+	permissions := Config.Permissions{
+		Intents:    map[string]Config.Permission{"playhorn": {Roles: []string{"1"}, Users: []string{"2"}}, "lock": {}},
+		RemoteBots: map[string]Config.Permission{"http://admin/": {Users: []string{"3"}}},
+	}
+	expected := "intent lock: nobody\nintent playhorn: <@&1> <@2>\nremote bot http://admin/: <@3>"
+	if description := describePermissions(permissions); description != expected {
+		t.Errorf("expected %q got %q", expected, description)
+	}
+}
@@ -0,0 +1,52 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/RasaNLU"
+	"time"
+)
+
+type PipelineEventType string
+
+const (
+	KeyPhraseDetected  PipelineEventType = "keyphrase"
+	PushToTalkPressed  PipelineEventType = "pushtotalk"
+	CommandTranscribed PipelineEventType = "transcript"
+	IntentParsed       PipelineEventType = "intent"
+	RemoteBotResponded PipelineEventType = "response"
+	CommandFailed      PipelineEventType = "error"
+	CommandCompleted   PipelineEventType = "completed"
+	//SessionStateChanged is sent for every command session transition with the new state as the text
+	SessionStateChanged PipelineEventType = "state"
+	//SlotPrompted is sent instead of RemoteBotResponded when an entity is asked for with the prompt as the text
+	SlotPrompted PipelineEventType = "prompt"
+	//PermissionDenied is sent instead of RemoteBotResponded when the user can't use the intent, the intent is the text
+	PermissionDenied PipelineEventType = "denied"
+	//RateLimited is sent when a user or guild is over a session or remote bot limit with the cooldown as the text
+	RateLimited PipelineEventType = "ratelimited"
+)
+
+//PipelineEvent is something that happened while a users voice went through the pipeline.
+//only the fields relevant to the event type are set
+type PipelineEvent struct {
+	Type              PipelineEventType
+	Time              time.Time
+	GuildId           string
+	VoiceChannelId    string
+	UserId            string
+	Text              string
+	ParserResponse    *RasaNLU.ParserResponse
+	RemoteBotResponse *RemoteBotResponse
+	Transition        *SessionTransition
+	Err               error
+	//Confidence is how sure the speech to text was of a CommandTranscribed
+	Confidence float32
+}
+
+//events are optional so nothing is sent if no one is listening
+func notifyPipelineEvent(pipelineEventNotify chan<- PipelineEvent, event PipelineEvent) {
+	if pipelineEventNotify == nil {
+		return
+	}
+	event.Time = time.Now()
+	pipelineEventNotify <- event
+}
@@ -0,0 +1,161 @@
+package VoiceRecognition
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+//PlaybackQueue plays audio into the voice channel one clip at a time so responses to users
+//giving commands at the same time don't talk over each other
+type PlaybackQueue struct {
+	voip  VOIPService
+	queue chan *playback
+	//closed stops anything being queued after the queue has been drained
+	mutex  sync.Mutex
+	closed bool
+	stop   chan bool
+	done   chan bool
+}
+
+type playback struct {
+	ctx        context.Context
+	opusFrames [][]byte
+	played     chan error
+	//pulses are only there to keep discord sending voice so are dropped if anything is queued
+	pulse bool
+}
+
+//a full silence frame, not the kind discord uses to detect a user starting or stopping speaking
+var realSilenceFrame = make([]byte, 80)
+
+var errPlaybackQueueClosed = errors.New("playback queue closed")
+
+func createPlaybackQueue(voip VOIPService) *PlaybackQueue {
+	pq := &PlaybackQueue{
+		voip:  voip,
+		queue: make(chan *playback, 100),
+		stop:  make(chan bool),
+		done:  make(chan bool),
+	}
+	go pq.start()
+	return pq
+}
+
+//Play queues a wave file. the returned channel gets nil once it has been played or the error
+//if it couldn't be
+func (pq *PlaybackQueue) Play(wave []byte) <-chan error {
+	return pq.PlayContext(context.Background(), wave)
+}
+
+//PlayContext stops playing part way through when ctx is cancelled so users can talk over
+//a response to stop it
+func (pq *PlaybackQueue) PlayContext(ctx context.Context, wave []byte) <-chan error {
+	played := make(chan error, 1)
+	opusFrames, err := waveToOpusFrames(wave)
+	if err != nil {
+		played <- err
+		return played
+	}
+	if !pq.enqueue(&playback{ctx: ctx, opusFrames: opusFrames, played: played}, true) {
+		played <- errPlaybackQueueClosed
+	}
+	return played
+}
+
+//pulse sends a single silence frame to force discord to keep sending voice while users are
+//giving commands. it is skipped if something else is going to be played
+func (pq *PlaybackQueue) pulse() {
+	if len(pq.queue) > 0 {
+		return
+	}
+	pq.enqueue(&playback{ctx: context.Background(), opusFrames: [][]byte{realSilenceFrame}, played: make(chan error, 1), pulse: true}, false)
+}
+
+func (pq *PlaybackQueue) enqueue(next *playback, wait bool) bool {
+	pq.mutex.Lock()
+	if pq.closed {
+		pq.mutex.Unlock()
+		return false
+	}
+	if !wait {
+		defer pq.mutex.Unlock()
+		select {
+		case pq.queue <- next:
+			return true
+		default:
+			return false
+		}
+	}
+	pq.mutex.Unlock()
+	//waiting for room is done without the lock so Close isn't held up by a full queue
+	select {
+	case pq.queue <- next:
+	case <-pq.stop:
+		return false
+	}
+	//Close might have drained the queue before this got in so anything left is failed here instead
+	pq.mutex.Lock()
+	defer pq.mutex.Unlock()
+	if pq.closed {
+		pq.drain()
+	}
+	return true
+}
+
+//drain fails everything still queued
+func (pq *PlaybackQueue) drain() {
+	for {
+		select {
+		case next := <-pq.queue:
+			next.played <- errPlaybackQueueClosed
+		default:
+			return
+		}
+	}
+}
+
+//Close stops playing once the current clip has finished. anything still queued isn't played
+func (pq *PlaybackQueue) Close() {
+	pq.mutex.Lock()
+	if !pq.closed {
+		pq.closed = true
+		close(pq.stop)
+	}
+	pq.mutex.Unlock()
+	<-pq.done
+}
+
+func (pq *PlaybackQueue) send(next *playback) error {
+	for _, opusFrame := range next.opusFrames {
+		select {
+		case <-next.ctx.Done():
+			return next.ctx.Err()
+		case pq.voip.OpusSend() <- opusFrame:
+		}
+	}
+	return nil
+}
+
+func (pq *PlaybackQueue) start() {
+	defer close(pq.done)
+	for {
+		select {
+		case next := <-pq.queue:
+			if next.pulse && len(pq.queue) > 0 {
+				next.played <- nil
+				continue
+			}
+			if err := next.ctx.Err(); err != nil {
+				next.played <- err
+				continue
+			}
+			pq.voip.Speaking(true)
+			next.played <- pq.send(next)
+			pq.voip.Speaking(false)
+		case <-pq.stop:
+			pq.drain()
+			return
+		}
+	}
+}
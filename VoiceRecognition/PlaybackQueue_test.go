@@ -0,0 +1,104 @@
+package VoiceRecognition
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlayContextCancelled(t *testing.T) {
+	voip := CreateFakeVOIPService()
+	voip.PlaybackInterval = 5 * time.Millisecond
+	playback := createPlaybackQueue(voip)
+	defer playback.Close()
+	response := toneWave(660, 2*time.Second)
+	next := toneWave(440, 100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	played := playback.PlayContext(ctx, response)
+	nextPlayed := playback.Play(next)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-played:
+		if err != context.Canceled {
+			t.Errorf("expected the response to be cancelled got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled response never stopped")
+	}
+	//whatever was queued behind it still plays
+	select {
+	case err := <-nextPlayed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("next clip was never played")
+	}
+	frames, err := waveToOpusFrames(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clips := voip.Clips()
+	if len(clips) != 2 || len(clips[0]) == 0 || len(clips[0]) >= len(frames) {
+		t.Errorf("expected the response to be cut short got clips of %d frames out of %d", len(clips[0]), len(frames))
+	}
+}
+
+func TestPlayContextAlreadyCancelled(t *testing.T) {
+	voip := CreateFakeVOIPService()
+	playback := createPlaybackQueue(voip)
+	defer playback.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := <-playback.PlayContext(ctx, toneWave(660, 100*time.Millisecond)); err != context.Canceled {
+		t.Errorf("expected nothing to be played got %v", err)
+	}
+	if clips := voip.Clips(); len(clips) != 0 {
+		t.Errorf("expected no clips got %d", len(clips))
+	}
+}
+
+func TestCloseWithFullQueue(t *testing.T) {
+	voip := CreateFakeVOIPService()
+	voip.PlaybackInterval = 5 * time.Millisecond
+	playback := createPlaybackQueue(voip)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	playing := playback.PlayContext(ctx, toneWave(660, 10*time.Second))
+	clip := toneWave(440, 20*time.Millisecond)
+	for len(playback.queue) < cap(playback.queue) {
+		playback.Play(clip)
+	}
+	//the queue is full so this waits for room
+	waiting := make(chan (<-chan error))
+	go func() {
+		waiting <- playback.Play(clip)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan bool)
+	go func() {
+		playback.Close()
+		close(closed)
+	}()
+	//closing doesn't wait for room in the queue, only for the current clip
+	select {
+	case played := <-waiting:
+		if err := <-played; err != errPlaybackQueueClosed {
+			t.Errorf("expected the waiting clip to be turned away got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting clip was held up until there was room in the queue")
+	}
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close never finished")
+	}
+	if err := <-playing; err != context.Canceled {
+		t.Errorf("expected the current clip to be cancelled got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+//defaultPushToTalkWindow is how long command recognition stays open when commands.activation.window isn't set
+const defaultPushToTalkWindow = 10 * time.Second
+
+var errNotInVoiceChannel = errors.New("not in the voice channel anymore")
+
+//PushToTalkRequest is a user asking to give a command without saying the key phrase
+type PushToTalkRequest struct {
+	GuildId string
+	//VoiceChannelId is the channel the user is in, empty if they aren't in one
+	VoiceChannelId string
+	UserId         string
+	//Reply tells the user if they can talk
+	Reply func(message string)
+}
+
+type pushToTalkRequest struct {
+	userId string
+	result chan pushToTalkResult
+}
+
+type pushToTalkResult struct {
+	window time.Duration
+	err    error
+}
+
+//RoutePushToTalk opens command recognition in the controller for the users voice channel. findController
+//returns nil if the bot isn't in the channel. it runs until requests is closed
+func RoutePushToTalk(requests <-chan PushToTalkRequest, findController func(guildId string, voiceChannelId string) *ChannelVoiceRecognitionController) {
+	for request := range requests {
+		if request.VoiceChannelId == "" {
+			request.Reply("Join a voice channel first")
+			continue
+		}
+		cvr := findController(request.GuildId, request.VoiceChannelId)
+		if cvr == nil {
+			request.Reply("I'm not in your voice channel")
+			continue
+		}
+		window, err := cvr.PushToTalk(request.UserId)
+		if err != nil {
+			request.Reply(fmt.Sprintf("I can't listen right now, %s", err))
+			continue
+		}
+		request.Reply(fmt.Sprintf("Listening for %s, go ahead", window))
+	}
+}
+
+//PushToTalk opens command recognition for the user without them saying the key phrase. it returns how
+//long they have to start talking
+func (cvr *ChannelVoiceRecognitionController) PushToTalk(userId string) (time.Duration, error) {
+	request := pushToTalkRequest{userId: userId, result: make(chan pushToTalkResult, 1)}
+	select {
+	case cvr.pushToTalkNotify <- request:
+	case <-cvr.stopped:
+		return 0, errNotInVoiceChannel
+	}
+	result := <-request.result
+	return result.window, result.err
+}
+
+//pushToTalk starts a session like the key phrase does but listens for the whole window
+func (cvr *ChannelVoiceRecognitionController) pushToTalk(userId string, window time.Duration) error {
+	connectedUser, known := cvr.channelConnectedUsers.byUserId[userId]
+	if known {
+		if _, exists := cvr.commandSessions[connectedUser.ssrc]; exists {
+			return errors.New("you're already giving a command")
+		}
+	}
+	if len(cvr.commandSessions) >= cvr.maxConcurrentCommands {
+		return fmt.Errorf("%d commands are already in progress", len(cvr.commandSessions))
+	}
+	//checked before waiting for the voice stream so users aren't told they're being listened to when they won't be
+	if !cvr.allowSession(userId) {
+		return errors.New("you're giving commands too quickly, try again in a bit")
+	}
+	if !known {
+		//discord only says which voice stream is whose once they start talking so wait for that
+		cvr.pendingPushToTalk[userId] = time.Now().Add(window)
+		return nil
+	}
+	cvr.startPushToTalk(userId, connectedUser.ssrc, window)
+	return nil
+}
+
+//startPushToTalk is pushToTalk once the checks have passed
+func (cvr *ChannelVoiceRecognitionController) startPushToTalk(userId string, ssrc uint32, window time.Duration) {
+	zap.S().Infof("user %s pushed to talk", userId)
+	cvr.notifyPipelineEvent(PipelineEvent{
+		Type:   PushToTalkPressed,
+		UserId: userId,
+	})
+	timeouts := make(SessionTimeouts)
+	for state, timeout := range cvr.sessionTimeouts {
+		timeouts[state] = timeout
+	}
+	timeouts[Listening] = window
+	session := cvr.createSession(ssrc, userId, timeouts)
+	session.state.Fire(TalkPushed)
+	cvr.startListening(session)
+}
+
+//wakeWord is false for users that only push to talk
+func (cvr *ChannelVoiceRecognitionController) wakeWord(userId string) bool {
+	return cvr.config.ActivationMode(cvr.guildId, userId) != Config.PushToTalk
+}
+
+func pushToTalkWindow(config Config.Config) time.Duration {
+	if config.Commands.Activation.Window > 0 {
+		return config.Commands.Activation.Window
+	}
+	return defaultPushToTalkWindow
+}
@@ -0,0 +1,142 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+//rateLimited is what a rate limit is counting
+type rateLimited string
+
+const (
+	sessionsLimited  rateLimited = "sessions"
+	remoteBotLimited rateLimited = "remotebot"
+)
+
+//rateLimits are shared by every controller and typed commands so a guild in several voice channels has
+//one limit
+var rateLimits = createRateLimiter(time.Now)
+
+//RateLimiter keeps a token bucket for each user and guild
+type RateLimiter struct {
+	mutex sync.Mutex
+	now   func() time.Time
+	//buckets are by what is limited then user or guild id
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+//now is a parameter so tests don't have to wait for buckets to refill
+func createRateLimiter(now func() time.Time) *RateLimiter {
+	return &RateLimiter{now: now, buckets: make(map[string]*tokenBucket)}
+}
+
+//allow takes a token from both the users and the guilds bucket. if either is empty neither is taken and
+//the wait is how long until there would be one
+func (rl *RateLimiter) allow(limited rateLimited, guildId string, userId string, config Config.Config) (bool, time.Duration) {
+	userLimit, guildLimit := config.Commands.RateLimits.Users.Sessions, config.Commands.RateLimits.Guilds.Sessions
+	if limited == remoteBotLimited {
+		userLimit, guildLimit = config.Commands.RateLimits.Users.RemoteBot, config.Commands.RateLimits.Guilds.RemoteBot
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	now := rl.now()
+	rl.forgetFull(now, config)
+	userBucket := rl.bucket(string(limited)+"/user/"+userId, userLimit, now)
+	guildBucket := rl.bucket(string(limited)+"/guild/"+guildId, guildLimit, now)
+	var wait time.Duration
+	for _, limit := range []struct {
+		bucket *tokenBucket
+		limit  Config.RateLimit
+	}{{userBucket, userLimit}, {guildBucket, guildLimit}} {
+		if limit.limit.Rate <= 0 || limit.bucket.tokens >= 1 {
+			continue
+		}
+		missing := time.Duration((1 - limit.bucket.tokens) * float64(limit.limit.Per) / float64(limit.limit.Rate))
+		if missing > wait {
+			wait = missing
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	if userLimit.Rate > 0 {
+		userBucket.tokens--
+	}
+	if guildLimit.Rate > 0 {
+		guildBucket.tokens--
+	}
+	return true, 0
+}
+
+//bucket is refilled up to now, new buckets start full
+func (rl *RateLimiter) bucket(key string, limit Config.RateLimit, now time.Time) *tokenBucket {
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updated: now}
+		rl.buckets[key] = bucket
+	}
+	if limit.Rate > 0 && limit.Per > 0 {
+		bucket.tokens += float64(now.Sub(bucket.updated)) / float64(limit.Per) * float64(limit.Rate)
+	}
+	if bucket.tokens > float64(limit.Burst) {
+		bucket.tokens = float64(limit.Burst)
+	}
+	bucket.updated = now
+	return bucket
+}
+
+//forgetFull drops buckets that would be full again so users that have left aren't kept forever. the
+//longest refill of any limit is used since buckets don't know which limit they are for
+func (rl *RateLimiter) forgetFull(now time.Time, config Config.Config) {
+	var refill time.Duration
+	for _, limit := range []Config.RateLimit{
+		config.Commands.RateLimits.Users.Sessions,
+		config.Commands.RateLimits.Users.RemoteBot,
+		config.Commands.RateLimits.Guilds.Sessions,
+		config.Commands.RateLimits.Guilds.RemoteBot,
+	} {
+		if limit.Rate <= 0 {
+			continue
+		}
+		if full := time.Duration(float64(limit.Per) * float64(limit.Burst) / float64(limit.Rate)); full > refill {
+			refill = full
+		}
+	}
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.updated) > refill {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+//allowSession checks the users and guilds session limits before a session is created
+func (cvr *ChannelVoiceRecognitionController) allowSession(userId string) bool {
+	allowed, wait := rateLimits.allow(sessionsLimited, cvr.guildId, userId, cvr.config)
+	if allowed {
+		delete(cvr.cooledDown, userId)
+		return true
+	}
+	zap.S().Infof("user %s is over the command session limit for another %s", userId, wait.Round(time.Second))
+	cvr.notifyPipelineEvent(PipelineEvent{
+		Type:   RateLimited,
+		UserId: userId,
+		Text:   cvr.config.Commands.RateLimits.Cooldown,
+	})
+	return false
+}
+
+func (cvr *ChannelVoiceRecognitionController) sayCooldown(cooldown string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := cvr.Say(ctx, cooldown); err != nil {
+		zap.S().Warnf("Failed to read out the cooldown: %s", err)
+	}
+}
@@ -0,0 +1,124 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"testing"
+	"time"
+)
+
+func rateLimitConfig(users Config.RateLimit, guilds Config.RateLimit) Config.Config {
+	config := testConfig(2)
+	config.Commands.RateLimits.Users.Sessions = users
+	config.Commands.RateLimits.Guilds.Sessions = guilds
+	config.Commands.RateLimits.Cooldown = "slow down"
+	return config
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Now()
+	rateLimiter := createRateLimiter(func() time.Time { return now })
+	config := rateLimitConfig(Config.RateLimit{Rate: 2, Per: time.Minute, Burst: 2}, Config.RateLimit{})
+	for i := 0; i < 2; i++ {
+		if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", "user1", config); !allowed {
+			t.Fatalf("expected the burst to be allowed, session %d wasn't", i)
+		}
+	}
+	allowed, wait := rateLimiter.allow(sessionsLimited, "guild", "user1", config)
+	if allowed || wait != 30*time.Second {
+		t.Errorf("expected to wait 30s for the next token got %v %s", allowed, wait)
+	}
+	if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", "user2", config); !allowed {
+		t.Error("expected other users to have their own bucket")
+	}
+	if allowed, _ := rateLimiter.allow(remoteBotLimited, "guild", "user1", config); !allowed {
+		t.Error("expected remote bot calls to be unlimited")
+	}
+	now = now.Add(30 * time.Second)
+	if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", "user1", config); !allowed {
+		t.Error("expected a token to be added after 30s")
+	}
+}
+
+func TestRateLimiterGuild(t *testing.T) {
+	now := time.Now()
+	rateLimiter := createRateLimiter(func() time.Time { return now })
+	config := rateLimitConfig(Config.RateLimit{Rate: 1, Per: time.Minute, Burst: 1}, Config.RateLimit{Rate: 2, Per: time.Minute, Burst: 2})
+	for _, userId := range []string{"user1", "user2"} {
+		if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", userId, config); !allowed {
+			t.Fatalf("expected %s to be allowed", userId)
+		}
+	}
+	if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", "user3", config); allowed {
+		t.Error("expected the guild to be over its limit")
+	}
+	//user3 was turned away by the guild so they still have their own token
+	if allowed, _ := rateLimiter.allow(sessionsLimited, "other", "user3", config); !allowed {
+		t.Error("expected other guilds to have their own bucket")
+	}
+	now = now.Add(30 * time.Second)
+	if allowed, _ := rateLimiter.allow(sessionsLimited, "guild", "user4", config); !allowed {
+		t.Error("expected the guild to have a token again after 30s")
+	}
+}
+
+//reads every phrase out as the same tone
+type toneTextToSpeech struct {
+	wave []byte
+}
+
+func (tts *toneTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	return tts.wave, nil
+}
+
+func TestKeyPhraseRateLimited(t *testing.T) {
+	_, processed := setupScriptedPipeline(t, "hey lydia", nil)
+	rateLimits = createRateLimiter(time.Now)
+	defer func() { rateLimits = createRateLimiter(time.Now) }()
+	cooldown := toneWave(330, 300*time.Millisecond)
+	voip := CreateFakeVOIPService()
+	config := rateLimitConfig(Config.RateLimit{Rate: 1, Per: time.Hour, Burst: 1}, Config.RateLimit{})
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, &toneTextToSpeech{wave: cooldown}, config, "guild", "voice", nil)
+	defer closeController(t, cvr)
+	listening := clipMatching(t, readSound(t, "Listening.wav"))
+
+	voip.AddSpeaker(1, VOIPUser{Id: "user1", Username: "user1"})
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, listening, 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was never processed")
+	}
+
+	//the cooldown is only read out the first time
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	waitForClips(t, voip, clipMatching(t, cooldown), 1)
+	voip.SpeakWave(1, toneWave(440, time.Second))
+	time.Sleep(500 * time.Millisecond)
+	if count := countClips(voip, clipMatching(t, cooldown)); count != 1 {
+		t.Errorf("expected the cooldown to be read out once got %d", count)
+	}
+	if count := countClips(voip, listening); count != 1 {
+		t.Errorf("expected the user to be turned away got %d listening clips", count)
+	}
+}
+
+func TestPushToTalkRateLimitedBeforeSpeaking(t *testing.T) {
+	setupScriptedPipeline(t, "hey lydia", nil)
+	rateLimits = createRateLimiter(time.Now)
+	defer func() { rateLimits = createRateLimiter(time.Now) }()
+	voip := CreateFakeVOIPService()
+	config := rateLimitConfig(Config.RateLimit{Rate: 1, Per: time.Hour, Burst: 1}, Config.RateLimit{})
+	cvr := CreateChannelVoiceRecognitionController(voip, &scriptedSpeechToText{transcript: "play air horn"}, nil, config, "guild", "voice", nil)
+	defer closeController(t, cvr)
+
+	//discord hasn't said which voice stream is the users yet so both wait for them to talk
+	if _, err := cvr.PushToTalk("user1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cvr.PushToTalk("user1"); err == nil {
+		t.Error("expected the user to be told they're over the limit before they talk")
+	}
+}
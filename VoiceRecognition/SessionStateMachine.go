@@ -0,0 +1,151 @@
+package VoiceRecognition
+
+import (
+	"fmt"
+	"time"
+)
+
+type SessionState string
+
+const (
+	//Idle is before the key phrase has been heard and after the session has finished
+	Idle SessionState = "idle"
+	//WakeDetected is after the key phrase or pushing to talk while command recognition is starting
+	WakeDetected SessionState = "wake"
+	Listening    SessionState = "listening"
+	//Understanding is working out what the command meant with rasa and the remote bot
+	Understanding SessionState = "understanding"
+	Responding    SessionState = "responding"
+	//FollowUp waits to listen again when the remote bot wants a reply
+	FollowUp SessionState = "followup"
+)
+
+type SessionEvent string
+
+const (
+	KeyPhraseHeard   SessionEvent = "keyphrase"
+	TalkPushed       SessionEvent = "pushtotalk"
+	ListeningStarted SessionEvent = "listening"
+	CommandHeard     SessionEvent = "command"
+	ResponseReady    SessionEvent = "response"
+	ResponseFinished SessionEvent = "finished"
+	ReplyExpected    SessionEvent = "reply"
+	//Cancelled, TimedOut and Failed end the session from any state
+	Cancelled SessionEvent = "cancelled"
+	TimedOut  SessionEvent = "timeout"
+	Failed    SessionEvent = "failed"
+)
+
+var sessionTransitions = map[SessionState]map[SessionEvent]SessionState{
+	Idle:          {KeyPhraseHeard: WakeDetected, TalkPushed: WakeDetected},
+	WakeDetected:  {ListeningStarted: Listening},
+	Listening:     {CommandHeard: Understanding},
+	Understanding: {ResponseReady: Responding},
+	Responding:    {ResponseFinished: Idle, ReplyExpected: FollowUp},
+	FollowUp:      {ListeningStarted: Listening},
+}
+
+//SessionTimeouts is how long a session can stay in each state before it times out. states
+//without a timeout can last forever
+type SessionTimeouts map[SessionState]time.Duration
+
+var defaultSessionTimeouts = SessionTimeouts{
+	WakeDetected:  5 * time.Second,
+	Listening:     20 * time.Second,
+	Understanding: 15 * time.Second,
+	Responding:    60 * time.Second,
+	FollowUp:      8 * time.Second,
+}
+
+type SessionTransition struct {
+	From  SessionState
+	To    SessionState
+	Event SessionEvent
+	Time  time.Time
+}
+
+//SessionTimeout is sent when a state has lasted too long. it is stale if the session has
+//moved on since it was set
+type SessionTimeout struct {
+	State      SessionState
+	transition int
+}
+
+//SessionStateMachine is the state of a single command session. it isn't safe to fire events
+//from more than one goroutine, the controller does everything from its own loop
+type SessionStateMachine struct {
+	state       SessionState
+	transitions int
+	timeouts    SessionTimeouts
+	//onTimeout is called from the timer goroutine
+	onTimeout func(SessionTimeout)
+	timer     *time.Timer
+	hooks     []func(SessionTransition)
+}
+
+//onTimeout is called from its own goroutine so should hand the timeout back to whatever is
+//firing events
+func createSessionStateMachine(timeouts SessionTimeouts, onTimeout func(SessionTimeout)) *SessionStateMachine {
+	return &SessionStateMachine{
+		state:     Idle,
+		timeouts:  timeouts,
+		onTimeout: onTimeout,
+	}
+}
+
+func (sm *SessionStateMachine) State() SessionState {
+	return sm.state
+}
+
+//Timeout is how long the session can stay in the state, 0 if there is no limit
+func (sm *SessionStateMachine) Timeout(state SessionState) time.Duration {
+	return sm.timeouts[state]
+}
+
+//AddHook calls hook after every transition
+func (sm *SessionStateMachine) AddHook(hook func(SessionTransition)) {
+	sm.hooks = append(sm.hooks, hook)
+}
+
+//Fire moves to the next state. events that don't make sense in the current state are an error
+//and leave the state alone
+func (sm *SessionStateMachine) Fire(event SessionEvent) error {
+	next, ok := sessionTransitions[sm.state][event]
+	if !ok && sm.state != Idle && (event == Cancelled || event == TimedOut || event == Failed) {
+		next, ok = Idle, true
+	}
+	if !ok {
+		return fmt.Errorf("session can't go from %s on %s", sm.state, event)
+	}
+	transition := SessionTransition{From: sm.state, To: next, Event: event, Time: time.Now()}
+	sm.state = next
+	sm.transitions++
+	sm.resetTimer()
+	for _, hook := range sm.hooks {
+		hook(transition)
+	}
+	return nil
+}
+
+//Expired fires TimedOut if the session is still where it was when the timeout was set
+func (sm *SessionStateMachine) Expired(timeout SessionTimeout) bool {
+	if timeout.transition != sm.transitions || timeout.State != sm.state {
+		return false
+	}
+	return sm.Fire(TimedOut) == nil
+}
+
+func (sm *SessionStateMachine) resetTimer() {
+	if sm.timer != nil {
+		sm.timer.Stop()
+		sm.timer = nil
+	}
+	duration, exists := sm.timeouts[sm.state]
+	if !exists || duration <= 0 || sm.onTimeout == nil {
+		return
+	}
+	timeout := SessionTimeout{State: sm.state, transition: sm.transitions}
+	sm.timer = time.AfterFunc(duration, func() {
+		sm.onTimeout(timeout)
+	})
+}
@@ -0,0 +1,78 @@
+package VoiceRecognition
+
+import (
+	"testing"
+	"time"
+)
+
+func fireAll(t *testing.T, sm *SessionStateMachine, events ...SessionEvent) {
+	for _, event := range events {
+		if err := sm.Fire(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionStateMachineTransitions(t *testing.T) {
+	sm := createSessionStateMachine(nil, nil)
+	var states []SessionState
+	sm.AddHook(func(transition SessionTransition) {
+		states = append(states, transition.To)
+	})
+	fireAll(t, sm, KeyPhraseHeard, ListeningStarted, CommandHeard, ResponseReady, ReplyExpected, ListeningStarted, CommandHeard, ResponseReady, ResponseFinished)
+	expected := []SessionState{WakeDetected, Listening, Understanding, Responding, FollowUp, Listening, Understanding, Responding, Idle}
+	if len(states) != len(expected) {
+		t.Fatalf("expected states %v got %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("expected states %v got %v", expected, states)
+		}
+	}
+}
+
+func TestSessionStateMachineRejectsInvalidEvents(t *testing.T) {
+	sm := createSessionStateMachine(nil, nil)
+	if err := sm.Fire(CommandHeard); err == nil {
+		t.Error("expected a command before the key phrase to be rejected")
+	}
+	if err := sm.Fire(Cancelled); err == nil {
+		t.Error("expected cancelling an idle session to be rejected")
+	}
+	fireAll(t, sm, KeyPhraseHeard, ListeningStarted)
+	if err := sm.Fire(ResponseFinished); err == nil {
+		t.Error("expected finishing a response while listening to be rejected")
+	}
+	if sm.State() != Listening {
+		t.Errorf("expected rejected events to leave the session listening got %s", sm.State())
+	}
+	fireAll(t, sm, Cancelled)
+	if sm.State() != Idle {
+		t.Errorf("expected cancelling to end the session got %s", sm.State())
+	}
+}
+
+func TestSessionStateMachineTimeout(t *testing.T) {
+	timeouts := make(chan SessionTimeout, 10)
+	sm := createSessionStateMachine(SessionTimeouts{Listening: 20 * time.Millisecond}, func(timeout SessionTimeout) {
+		timeouts <- timeout
+	})
+	fireAll(t, sm, KeyPhraseHeard, ListeningStarted)
+	var timeout SessionTimeout
+	select {
+	case timeout = <-timeouts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listening never timed out")
+	}
+	if timeout.State != Listening {
+		t.Errorf("expected listening to time out got %s", timeout.State)
+	}
+	if !sm.Expired(timeout) || sm.State() != Idle {
+		t.Errorf("expected the timeout to end the session got %s", sm.State())
+	}
+	//a timeout from before the session moved on is ignored
+	fireAll(t, sm, KeyPhraseHeard)
+	if sm.Expired(timeout) || sm.State() != WakeDetected {
+		t.Errorf("expected a stale timeout to be ignored got %s", sm.State())
+	}
+}
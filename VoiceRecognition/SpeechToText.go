@@ -0,0 +1,108 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/RasaNLU"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+type Transcript struct {
+	Text       string
+	Final      bool
+	Confidence float32
+	//Segments is only set by providers that split the transcript up
+	Segments []TranscriptSegment
+}
+
+type TranscriptSegment struct {
+	Text       string
+	Confidence float32
+	Start      time.Duration
+	End        time.Duration
+}
+
+//SpeechToText is a speech recognition engine used to transcribe a users command
+type SpeechToText interface {
+	//StartStream opens a recognition stream for a single command
+	StartStream(ctx context.Context) (SpeechToTextStream, error)
+}
+
+type SpeechToTextStream interface {
+	//SendPCM pushes 48khz stereo pcm, the same as discord voice after opus decoding
+	SendPCM(pcm []int16) error
+	//Transcripts receives interim and final transcripts. it is closed once the stream has
+	//finished, Err tells if that was because of an error
+	Transcripts() <-chan Transcript
+	Err() error
+	//Close stops sending audio. any final transcript still being worked out will be sent
+	Close() error
+}
+
+//UtteranceEndpointer is implemented by streams that can't tell when the user has finished
+//their command by themselves and use discords speaking and silence signals instead
+type UtteranceEndpointer interface {
+	SpeakingChanged(speaking bool)
+}
+
+//FallbackSpeechToText uses the Fallback provider whenever the Primary can't start a stream
+type FallbackSpeechToText struct {
+	Primary  SpeechToText
+	Fallback SpeechToText
+}
+
+func (f *FallbackSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	stream, err := f.Primary.StartStream(ctx)
+	if err == nil {
+		return stream, nil
+	}
+	zap.S().Warnf("Could not start speech to text, using fallback: %v", err)
+	return f.Fallback.StartStream(ctx)
+}
+
+//CreateSpeechToText creates the provider selected in the config wrapped with the fallback if one is set
+func CreateSpeechToText(config Config.Config) (SpeechToText, error) {
+	speechToText, err := createSpeechToTextProvider(config.SpeechToText.Provider, config)
+	if err != nil || config.SpeechToText.Fallback == "" {
+		return speechToText, err
+	}
+	fallback, err := createSpeechToTextProvider(config.SpeechToText.Fallback, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create fallback speech to text: %v", err)
+	}
+	return &FallbackSpeechToText{Primary: speechToText, Fallback: fallback}, nil
+}
+
+func createSpeechToTextProvider(provider string, config Config.Config) (SpeechToText, error) {
+	switch provider {
+	case "", "google":
+		return &GoogleSpeechToText{
+			LanguageCode:  config.SpeechToText.Language,
+			ClientOptions: GoogleClientOptions(config),
+		}, nil
+	case "vosk":
+		return &VoskSpeechToText{
+			ModelPath: config.SpeechToText.Vosk.Model,
+			ServerURL: config.SpeechToText.Vosk.Server,
+		}, nil
+	case "whisper":
+		//whisper only wants the language not the region
+		language := strings.SplitN(config.SpeechToText.Language, "-", 2)[0]
+		return &WhisperSpeechToText{
+			ModelPath: config.SpeechToText.Whisper.Model,
+			Language:  strings.ToLower(language),
+			Threads:   config.SpeechToText.Whisper.Threads,
+		}, nil
+	case "sphinx":
+		trainData, err := RasaNLU.LoadTrainData(config.Rasa.TrainingData)
+		if err != nil {
+			return nil, err
+		}
+		return CreateSphinxSpeechToText(config.Sphinx.HMM, config.Sphinx.Dict, config.Sphinx.LogFile, trainData)
+	default:
+		return nil, fmt.Errorf("unknown speech to text provider %s", provider)
+	}
+}
@@ -0,0 +1,188 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/RasaNLU"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xlab/pocketsphinx-go/sphinx"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+)
+
+const sphinxCommandSearch = "commands"
+
+//SphinxSpeechToText recognises commands with pocketsphinx using a grammar made from the
+//rasa training examples. it can only understand commands it has been trained on but
+//needs nothing other than sphinx which is already used for the key phrase
+type SphinxSpeechToText struct {
+	HMM     string
+	Dict    string
+	LogFile string
+	//Grammar is jsgf listing every command that can be recognised
+	Grammar string
+}
+
+type sphinxStream struct {
+	sphinxListener SphinxListener
+	downsampler    pcmDownsampleBuffer
+	transcripts    chan Transcript
+	finished       bool
+}
+
+func CreateSphinxSpeechToText(hmm string, dict string, logFile string, trainData RasaNLU.TrainData) (*SphinxSpeechToText, error) {
+	dictionary, err := loadSphinxDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+	grammar, err := generateCommandGrammar(trainData, dictionary)
+	if err != nil {
+		return nil, err
+	}
+	return &SphinxSpeechToText{HMM: hmm, Dict: dict, LogFile: logFile, Grammar: grammar}, nil
+}
+
+//every stream gets its own decoder since they can't be shared between users
+func (s *SphinxSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	sphinxConfig := sphinx.NewConfig(
+		sphinx.LogFileOption(s.LogFile),
+		sphinx.HMMDirOption(s.HMM),
+		sphinx.DictFileOption(s.Dict),
+	)
+	decoder, err := sphinx.NewDecoder(sphinxConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !decoder.SetJSGFString(sphinxCommandSearch, sphinx.String(s.Grammar)) || !decoder.SetSearch(sphinxCommandSearch) {
+		decoder.Destroy()
+		return nil, errors.New("sphinx failed to load the command grammar")
+	}
+	if !decoder.StartUtt() {
+		decoder.Destroy()
+		return nil, errors.New("sphinx failed to start utt")
+	}
+	return &sphinxStream{
+		sphinxListener: SphinxListener{dec: decoder},
+		transcripts:    make(chan Transcript, 1),
+	}, nil
+}
+
+//works the same as key phrase listening. the hypothesis is taken when speech turns to silence
+func (ss *sphinxStream) SendPCM(pcm []int16) error {
+	if ss.finished {
+		return nil
+	}
+	monoPCM, err := ss.downsampler.push(pcm)
+	if err != nil || len(monoPCM) == 0 {
+		return err
+	}
+	if _, ok := ss.sphinxListener.dec.ProcessRaw(monoPCM, false, false); !ok {
+		return errors.New("sphinx failed to process audio")
+	}
+	if ss.sphinxListener.dec.IsInSpeech() {
+		ss.sphinxListener.inSpeech = true
+		ss.sphinxListener.uttStarted = true
+		return nil
+	}
+	if ss.sphinxListener.uttStarted {
+		ss.finish()
+	}
+	return nil
+}
+
+func (ss *sphinxStream) Transcripts() <-chan Transcript {
+	return ss.transcripts
+}
+
+func (ss *sphinxStream) Err() error {
+	return nil
+}
+
+func (ss *sphinxStream) Close() error {
+	if ss.finished {
+		return nil
+	}
+	monoPCM, err := ss.downsampler.flush()
+	if err == nil && len(monoPCM) > 0 {
+		ss.sphinxListener.dec.ProcessRaw(monoPCM, false, false)
+	}
+	ss.finish()
+	return err
+}
+
+func (ss *sphinxStream) finish() {
+	ss.finished = true
+	ss.sphinxListener.dec.EndUtt()
+	hyp, _ := ss.sphinxListener.dec.Hypothesis()
+	if len(hyp) > 0 {
+		//copy the hypothesis before the decoder is destroyed and frees it
+		safeHyp := (hyp + " ")[:len(hyp)]
+		ss.transcripts <- Transcript{Text: safeHyp, Final: true}
+	}
+	ss.sphinxListener.dec.Destroy()
+	close(ss.transcripts)
+}
+
+//the first word on each line is the word, alternate pronunciations are marked like word(2)
+func loadSphinxDictionary(dict string) (map[string]bool, error) {
+	file, err := os.Open(dict)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dictionary := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		word := fields[0]
+		if i := strings.Index(word, "("); i > 0 {
+			word = word[:i]
+		}
+		dictionary[strings.ToLower(word)] = true
+	}
+	return dictionary, scanner.Err()
+}
+
+//builds a jsgf grammar where each training example is one alternative. sphinx won't load a
+//grammar with words missing from the dictionary so those examples are left out
+func generateCommandGrammar(trainData RasaNLU.TrainData, dictionary map[string]bool) (string, error) {
+	var alternatives []string
+	seen := make(map[string]bool)
+	for _, example := range trainData.CommonExamples {
+		words := strings.Fields(strings.ToLower(strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '\'' {
+				return r
+			}
+			return ' '
+		}, example.Text)))
+		if len(words) == 0 {
+			continue
+		}
+		missingWord := ""
+		for _, word := range words {
+			if !dictionary[word] {
+				missingWord = word
+				break
+			}
+		}
+		if missingWord != "" {
+			zap.S().Infof("Leaving \"%s\" out of the sphinx command grammar, \"%s\" is not in the dictionary", example.Text, missingWord)
+			continue
+		}
+		alternative := strings.Join(words, " ")
+		if seen[alternative] {
+			continue
+		}
+		seen[alternative] = true
+		alternatives = append(alternatives, alternative)
+	}
+	if len(alternatives) == 0 {
+		return "", errors.New("no training examples can be used for the sphinx command grammar")
+	}
+	return fmt.Sprintf("#JSGF V1.0;\ngrammar %s;\npublic <command> = %s;\n", sphinxCommandSearch, strings.Join(alternatives, " | ")), nil
+}
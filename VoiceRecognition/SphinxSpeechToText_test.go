@@ -0,0 +1,28 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/RasaNLU"
+	"testing"
+)
+
+func TestCommandGrammarSkipsUnknownWords(t *testing.T) {
+	dictionary := map[string]bool{"play": true, "air": true, "horn": true, "the": true}
+	trainData := RasaNLU.TrainData{CommonExamples: []RasaNLU.Example{
+		{Text: "Play air horn!"},
+		{Text: "play the air horn"},
+		{Text: "play air horn"},
+		{Text: "play despacito"},
+	}}
+	grammar, err := generateCommandGrammar(trainData, dictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "#JSGF V1.0;\ngrammar commands;\npublic <command> = play air horn | play the air horn;\n"
+	if grammar != expected {
+		t.Errorf("unexpected grammar %q", grammar)
+	}
+
+	if _, err := generateCommandGrammar(RasaNLU.TrainData{CommonExamples: []RasaNLU.Example{{Text: "play despacito"}}}, dictionary); err == nil {
+		t.Error("expected an error when no examples can be used")
+	}
+}
@@ -0,0 +1,186 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"go.uber.org/zap"
+)
+
+type SummonAction string
+
+const (
+	//SummonJoin joins the voice channel the user is in, moving from another channel in the same guild
+	SummonJoin SummonAction = "join"
+	//SummonLeave leaves whichever voice channel the bot is in for the guild
+	SummonLeave SummonAction = "leave"
+)
+
+//Summon is a user asking the bot to come to or leave their voice channel
+type Summon struct {
+	Action  SummonAction
+	GuildId string
+	UserId  string
+	//VoiceChannelId is the channel the user is in, empty if they aren't in one
+	VoiceChannelId string
+	//Reply tells the user what happened. can be nil
+	Reply func(message string)
+}
+
+func (summon Summon) reply(message string) {
+	if summon.Reply != nil {
+		summon.Reply(message)
+	}
+}
+
+//ChannelOccupancy is how many users, not counting bots, are in a voice channel after someone joined or left
+type ChannelOccupancy struct {
+	GuildId        string
+	VoiceChannelId string
+	Users          int
+}
+
+//Summoner joins voice channels when users ask instead of the channels in the config.
+//there is only one channel per guild so joining from another channel moves the bot, and it
+//leaves once everyone else has
+type Summoner struct {
+	createVOIPService   func() VOIPService
+	speechToText        SpeechToText
+	textToSpeech        TextToSpeech
+	config              Config.Config
+	pipelineEventNotify chan<- PipelineEvent
+	summons             <-chan Summon
+	occupancy           <-chan ChannelOccupancy
+	configNotify        <-chan Config.Config
+	//controllers are by guild id
+	controllers        map[string]*ChannelVoiceRecognitionController
+	controllerRequests chan controllerRequest
+	close              chan chan bool
+	stopped            chan bool
+}
+
+type controllerRequest struct {
+	guildId        string
+	voiceChannelId string
+	found          chan *ChannelVoiceRecognitionController
+}
+
+//createVOIPService is called for every channel joined. pipelineEventNotify is shared by every channel and can be nil
+func CreateSummoner(summons <-chan Summon, occupancy <-chan ChannelOccupancy, createVOIPService func() VOIPService, speechToText SpeechToText, textToSpeech TextToSpeech, config Config.Config, pipelineEventNotify chan<- PipelineEvent) *Summoner {
+	summoner := &Summoner{
+		createVOIPService:   createVOIPService,
+		speechToText:        speechToText,
+		textToSpeech:        textToSpeech,
+		config:              config,
+		pipelineEventNotify: pipelineEventNotify,
+		summons:             summons,
+		occupancy:           occupancy,
+		configNotify:        Config.Subscribe(),
+		controllers:         make(map[string]*ChannelVoiceRecognitionController),
+		controllerRequests:  make(chan controllerRequest),
+		close:               make(chan chan bool),
+		stopped:             make(chan bool),
+	}
+	go summoner.start()
+	return summoner
+}
+
+func (s *Summoner) start() {
+	for {
+		select {
+		case summon := <-s.summons:
+			switch summon.Action {
+			case SummonJoin:
+				s.join(summon)
+			case SummonLeave:
+				if _, exists := s.controllers[summon.GuildId]; !exists {
+					summon.reply("I'm not in a voice channel")
+					continue
+				}
+				s.leave(summon.GuildId)
+				summon.reply("Left the voice channel")
+			}
+
+		case occupancy := <-s.occupancy:
+			cvr, exists := s.controllers[occupancy.GuildId]
+			if !exists || cvr.voiceChannelId != occupancy.VoiceChannelId || occupancy.Users > 0 {
+				continue
+			}
+			zap.S().Infof("everyone left voice channel %s in guild %s", occupancy.VoiceChannelId, occupancy.GuildId)
+			s.leave(occupancy.GuildId)
+
+		case request := <-s.controllerRequests:
+			cvr, exists := s.controllers[request.guildId]
+			if !exists || cvr.voiceChannelId != request.voiceChannelId {
+				request.found <- nil
+				continue
+			}
+			request.found <- cvr
+
+		case config := <-s.configNotify:
+			s.config = config
+
+		case complete := <-s.close:
+			Config.Unsubscribe(s.configNotify)
+			close(s.stopped)
+			for guildId := range s.controllers {
+				s.leave(guildId)
+			}
+			complete <- true
+			return
+		}
+	}
+}
+
+func (s *Summoner) join(summon Summon) {
+	if summon.VoiceChannelId == "" {
+		summon.reply("Join a voice channel first")
+		return
+	}
+	cvr, exists := s.controllers[summon.GuildId]
+	if exists && cvr.voiceChannelId == summon.VoiceChannelId {
+		summon.reply("I'm already in your voice channel")
+		return
+	}
+	if exists {
+		zap.S().Infof("user %s moved the bot from voice channel %s to %s in guild %s", summon.UserId, cvr.voiceChannelId, summon.VoiceChannelId, summon.GuildId)
+		s.leave(summon.GuildId)
+	}
+	zap.S().Infof("user %s summoned the bot to voice channel %s in guild %s", summon.UserId, summon.VoiceChannelId, summon.GuildId)
+	joined, err := joinChannelVoiceRecognitionController(s.createVOIPService(), s.speechToText, s.textToSpeech, s.config, summon.GuildId, summon.VoiceChannelId, s.pipelineEventNotify)
+	if err != nil {
+		zap.S().Warn(err)
+		summon.reply("I couldn't join your voice channel")
+		return
+	}
+	s.controllers[summon.GuildId] = &joined
+	if exists {
+		summon.reply("Moved to your voice channel")
+		return
+	}
+	summon.reply("Joined your voice channel")
+}
+
+//leave waits for the controller to close so the guild's voice connection is free to join again
+func (s *Summoner) leave(guildId string) {
+	cvr := s.controllers[guildId]
+	delete(s.controllers, guildId)
+	zap.S().Infof("leaving voice channel %s in guild %s", cvr.voiceChannelId, guildId)
+	<-cvr.Close()
+}
+
+//Controller is the controller for the voice channel, or nil if the bot isn't in it
+func (s *Summoner) Controller(guildId string, voiceChannelId string) *ChannelVoiceRecognitionController {
+	request := controllerRequest{guildId: guildId, voiceChannelId: voiceChannelId, found: make(chan *ChannelVoiceRecognitionController, 1)}
+	select {
+	case s.controllerRequests <- request:
+	case <-s.stopped:
+		return nil
+	}
+	return <-request.found
+}
+
+//Close leaves every voice channel, complete is sent to once they have all been left
+func (s *Summoner) Close() chan bool {
+	complete := make(chan bool)
+	s.close <- complete
+	return complete
+}
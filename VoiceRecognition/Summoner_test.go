@@ -0,0 +1,118 @@
+package VoiceRecognition
+
+import (
+	"testing"
+	"time"
+)
+
+type summonerTest struct {
+	summons   chan Summon
+	occupancy chan ChannelOccupancy
+	voips     chan *FakeVOIPService
+	summoner  *Summoner
+}
+
+func createSummonerTest(t *testing.T) *summonerTest {
+	setupScriptedPipeline(t, "hey lydia", nil)
+	st := &summonerTest{
+		summons:   make(chan Summon),
+		occupancy: make(chan ChannelOccupancy),
+		voips:     make(chan *FakeVOIPService, 10),
+	}
+	createVOIPService := func() VOIPService {
+		voip := CreateFakeVOIPService()
+		st.voips <- voip
+		return voip
+	}
+	st.summoner = CreateSummoner(st.summons, st.occupancy, createVOIPService, &scriptedSpeechToText{}, nil, testConfig(1), nil)
+	t.Cleanup(func() {
+		select {
+		case <-st.summoner.Close():
+		case <-time.After(5 * time.Second):
+			t.Fatal("summoner did not close")
+		}
+	})
+	return st
+}
+
+//summon waits for the reply so everything sent before it has been handled
+func (st *summonerTest) summon(t *testing.T, action SummonAction, voiceChannelId string) string {
+	replies := make(chan string, 1)
+	st.summons <- Summon{
+		Action:         action,
+		GuildId:        "guild",
+		UserId:         "user",
+		VoiceChannelId: voiceChannelId,
+		Reply: func(message string) {
+			replies <- message
+		},
+	}
+	select {
+	case reply := <-replies:
+		return reply
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reply to %s %s", action, voiceChannelId)
+	}
+	return ""
+}
+
+func (st *summonerTest) nextVOIPService(t *testing.T) *FakeVOIPService {
+	select {
+	case voip := <-st.voips:
+		return voip
+	default:
+		t.Fatal("no voice channel was joined")
+	}
+	return nil
+}
+
+func TestSummonJoinMoveAndLeave(t *testing.T) {
+	st := createSummonerTest(t)
+
+	if reply := st.summon(t, SummonJoin, ""); reply != "Join a voice channel first" {
+		t.Errorf("expected to be asked to join a voice channel got %q", reply)
+	}
+	if reply := st.summon(t, SummonJoin, "voice1"); reply != "Joined your voice channel" {
+		t.Errorf("expected to join got %q", reply)
+	}
+	voip1 := st.nextVOIPService(t)
+	if reply := st.summon(t, SummonJoin, "voice1"); reply != "I'm already in your voice channel" {
+		t.Errorf("expected to already be there got %q", reply)
+	}
+	if reply := st.summon(t, SummonJoin, "voice2"); reply != "Moved to your voice channel" {
+		t.Errorf("expected to move got %q", reply)
+	}
+	voip2 := st.nextVOIPService(t)
+	if voip1.Joined() || !voip2.Joined() {
+		t.Errorf("expected to have left the first channel for the second")
+	}
+	if reply := st.summon(t, SummonLeave, ""); reply != "Left the voice channel" {
+		t.Errorf("expected to leave got %q", reply)
+	}
+	if voip2.Joined() {
+		t.Errorf("expected to have left the voice channel")
+	}
+	if reply := st.summon(t, SummonLeave, ""); reply != "I'm not in a voice channel" {
+		t.Errorf("expected to not be in a channel got %q", reply)
+	}
+}
+
+func TestSummonLeavesEmptyChannel(t *testing.T) {
+	st := createSummonerTest(t)
+	st.summon(t, SummonJoin, "voice1")
+	voip := st.nextVOIPService(t)
+
+	//other channels emptying and users still being around don't count
+	st.occupancy <- ChannelOccupancy{GuildId: "guild", VoiceChannelId: "voice2", Users: 0}
+	st.occupancy <- ChannelOccupancy{GuildId: "guild", VoiceChannelId: "voice1", Users: 1}
+	if reply := st.summon(t, SummonJoin, "voice1"); reply != "I'm already in your voice channel" || !voip.Joined() {
+		t.Fatalf("expected to still be in the voice channel got %q", reply)
+	}
+	st.occupancy <- ChannelOccupancy{GuildId: "guild", VoiceChannelId: "voice1", Users: 0}
+	if reply := st.summon(t, SummonLeave, ""); reply != "I'm not in a voice channel" {
+		t.Errorf("expected to have left the empty channel got %q", reply)
+	}
+	if voip.Joined() {
+		t.Errorf("expected to have left the voice channel")
+	}
+}
@@ -0,0 +1,152 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/RasaNLU"
+	"go.uber.org/zap"
+)
+
+//MirroredInteraction is one command from the key phrase being heard to the response being read out
+type MirroredInteraction struct {
+	GuildId        string
+	VoiceChannelId string
+	UserId         string
+	KeyPhrase      string
+	Transcript     string
+	ParserResponse *RasaNLU.ParserResponse
+	//Response is the remote bots response, the prompt asking for an entity, the cooldown or that permission was denied
+	Response string
+	//Ended is the session event that finished the interaction e.g. finished, reply, cancelled or timeout
+	Ended SessionEvent
+	Err   error
+}
+
+//InteractionPoster posts finished interactions to a text channel
+type InteractionPoster interface {
+	PostInteraction(textChannelId string, interaction MirroredInteraction) error
+}
+
+//TextChannelMirror follows pipeline events from every controller and posts each interaction to
+//the text channel of the voice channel it happened in, for guilds that have mirroring turned on
+type TextChannelMirror struct {
+	poster         InteractionPoster
+	config         Config.Config
+	configNotify   <-chan Config.Config
+	pipelineEvents <-chan PipelineEvent
+	//interactions in progress by guild, voice channel and user
+	interactions map[string]*MirroredInteraction
+	//sessions are the interactions that got as far as a command session
+	sessions map[string]bool
+	close    chan chan bool
+}
+
+func CreateTextChannelMirror(poster InteractionPoster, config Config.Config, pipelineEvents <-chan PipelineEvent) *TextChannelMirror {
+	mirror := &TextChannelMirror{
+		poster:         poster,
+		config:         config,
+		configNotify:   Config.Subscribe(),
+		pipelineEvents: pipelineEvents,
+		interactions:   make(map[string]*MirroredInteraction),
+		sessions:       make(map[string]bool),
+		close:          make(chan chan bool),
+	}
+	go mirror.start()
+	return mirror
+}
+
+func (m *TextChannelMirror) start() {
+	for {
+		select {
+		case event := <-m.pipelineEvents:
+			m.record(event)
+		case config := <-m.configNotify:
+			m.config = config
+		case complete := <-m.close:
+			Config.Unsubscribe(m.configNotify)
+			complete <- true
+			return
+		}
+	}
+}
+
+func (m *TextChannelMirror) record(event PipelineEvent) {
+	key := event.GuildId + "/" + event.VoiceChannelId + "/" + event.UserId
+	interaction, exists := m.interactions[key]
+	switch {
+	//saying cancel part way through a session doesn't start a new interaction, anything else left from
+	//before e.g. a key phrase that was turned away is replaced
+	case (event.Type == KeyPhraseDetected || event.Type == PushToTalkPressed) && !m.sessions[key]:
+		interaction = m.startInteraction(key, event)
+	//a follow up starts its own session
+	case !exists && event.Type == SessionStateChanged && event.Transition.To != Idle && event.Transition.To != FollowUp:
+		interaction = m.startInteraction(key, event)
+	case !exists:
+		//late events from a cancelled session aren't part of any interaction
+		return
+	}
+	switch event.Type {
+	case KeyPhraseDetected:
+		if interaction.KeyPhrase == "" {
+			interaction.KeyPhrase = event.Text
+		}
+	case CommandTranscribed:
+		interaction.Transcript = event.Text
+	case IntentParsed:
+		interaction.ParserResponse = event.ParserResponse
+	case RateLimited:
+		//turned away before a session started so there is nothing to post, the cooldown mustn't end up
+		//as the response to their next command
+		if !m.sessions[key] {
+			delete(m.interactions, key)
+			return
+		}
+		interaction.Response = event.Text
+	case RemoteBotResponded, SlotPrompted:
+		interaction.Response = event.Text
+	case PermissionDenied:
+		interaction.Response = permissionDeniedResponse
+	case CommandFailed:
+		interaction.Err = event.Err
+	case SessionStateChanged:
+		//a follow up is posted as its own interaction
+		if event.Transition.To != Idle && event.Transition.To != FollowUp {
+			m.sessions[key] = true
+			return
+		}
+		delete(m.interactions, key)
+		delete(m.sessions, key)
+		interaction.Ended = event.Transition.Event
+		m.post(*interaction)
+	}
+}
+
+func (m *TextChannelMirror) startInteraction(key string, event PipelineEvent) *MirroredInteraction {
+	interaction := &MirroredInteraction{GuildId: event.GuildId, VoiceChannelId: event.VoiceChannelId, UserId: event.UserId}
+	m.interactions[key] = interaction
+	return interaction
+}
+
+//posting happens in the background so the pipeline isn't held up waiting on discord
+func (m *TextChannelMirror) post(interaction MirroredInteraction) {
+	//sessions that timed out before anything was said aren't worth posting
+	if interaction.Transcript == "" || !m.config.Mirrored(interaction.GuildId) {
+		return
+	}
+	textChannelId := m.config.DiscordChannel(interaction.GuildId, interaction.VoiceChannelId).TextChannel
+	if textChannelId == "" {
+		zap.S().Debugf("not mirroring interaction in voice channel %s, it has no text channel", interaction.VoiceChannelId)
+		return
+	}
+	go func() {
+		if err := m.poster.PostInteraction(textChannelId, interaction); err != nil {
+			zap.S().Warnf("Failed to mirror interaction to text channel %s: %s", textChannelId, err)
+		}
+	}()
+}
+
+//Close stops mirroring. controllers sending to the mirror should be closed first
+func (m *TextChannelMirror) Close() chan bool {
+	complete := make(chan bool)
+	m.close <- complete
+	return complete
+}
@@ -0,0 +1,209 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/RasaNLU"
+	"errors"
+	"testing"
+	"time"
+)
+
+type postedInteraction struct {
+	textChannelId string
+	interaction   MirroredInteraction
+}
+
+type recordingPoster struct {
+	posted chan postedInteraction
+}
+
+func (rp *recordingPoster) PostInteraction(textChannelId string, interaction MirroredInteraction) error {
+	rp.posted <- postedInteraction{textChannelId: textChannelId, interaction: interaction}
+	return nil
+}
+
+func createMirrorTest(t *testing.T, config Config.Config) (chan PipelineEvent, chan postedInteraction) {
+	pipelineEvents := make(chan PipelineEvent)
+	poster := &recordingPoster{posted: make(chan postedInteraction, 10)}
+	mirror := CreateTextChannelMirror(poster, config, pipelineEvents)
+	t.Cleanup(func() {
+		<-mirror.Close()
+	})
+	return pipelineEvents, poster.posted
+}
+
+func sessionEnded(guildId string, userId string, to SessionState, event SessionEvent) PipelineEvent {
+	return PipelineEvent{
+		Type:       SessionStateChanged,
+		GuildId:    guildId,
+		UserId:     userId,
+		Text:       string(to),
+		Transition: &SessionTransition{From: Responding, To: to, Event: event},
+	}
+}
+
+func TestMirrorPostsInteraction(t *testing.T) {
+	var config Config.Config
+	config.Discord.Guild = "guild"
+	config.Discord.TextChannel = "text"
+	config.Discord.Mirror.Enabled = true
+	pipelineEvents, posted := createMirrorTest(t, config)
+
+	remoteBotErr := errors.New("remote bot unreachable")
+	parserResponse := &RasaNLU.ParserResponse{Intent: RasaNLU.Intent{Name: "playhorn", Confidence: 0.9}}
+	for _, event := range []PipelineEvent{
+		{Type: KeyPhraseDetected, GuildId: "guild", UserId: "user", Text: "hey lydia"},
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play fog horn"},
+		{Type: IntentParsed, GuildId: "guild", UserId: "user", ParserResponse: parserResponse},
+		{Type: RemoteBotResponded, GuildId: "guild", UserId: "user", Text: "playing fog horn"},
+		sessionEnded("guild", "user", Idle, ResponseFinished),
+		//nothing was said so there is nothing to post
+		{Type: KeyPhraseDetected, GuildId: "guild", UserId: "user", Text: "hey lydia"},
+		sessionEnded("guild", "user", Idle, TimedOut),
+		{Type: KeyPhraseDetected, GuildId: "guild", UserId: "user", Text: "hey lydia"},
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play horn"},
+		{Type: CommandFailed, GuildId: "guild", UserId: "user", Err: remoteBotErr},
+		sessionEnded("guild", "user", Idle, Failed),
+	} {
+		pipelineEvents <- event
+	}
+
+	expected := []MirroredInteraction{
+		{GuildId: "guild", UserId: "user", KeyPhrase: "hey lydia", Transcript: "play fog horn", ParserResponse: parserResponse, Response: "playing fog horn", Ended: ResponseFinished},
+		{GuildId: "guild", UserId: "user", KeyPhrase: "hey lydia", Transcript: "play horn", Ended: Failed, Err: remoteBotErr},
+	}
+	//posting happens in the background so the order isn't fixed
+	received := make(map[string]postedInteraction)
+	for len(received) < len(expected) {
+		select {
+		case post := <-posted:
+			received[post.interaction.Transcript] = post
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only got %d interactions", len(received))
+		}
+	}
+	for _, interaction := range expected {
+		post := received[interaction.Transcript]
+		if post.textChannelId != "text" {
+			t.Errorf("expected %q to be posted to the text channel got %q", interaction.Transcript, post.textChannelId)
+		}
+		if post.interaction != interaction {
+			t.Errorf("expected %+v got %+v", interaction, post.interaction)
+		}
+	}
+}
+
+func TestMirrorOnlyMirroredGuilds(t *testing.T) {
+	var config Config.Config
+	config.Discord.Channels = []Config.DiscordChannel{
+		{Guild: "guild1", VoiceChannel: "voice", TextChannel: "text1"},
+		{Guild: "guild2", VoiceChannel: "voice", TextChannel: "text2"},
+	}
+	config.Discord.Mirror.Guilds = map[string]bool{"guild2": true}
+	pipelineEvents, posted := createMirrorTest(t, config)
+
+	for _, guildId := range []string{"guild1", "guild2"} {
+		pipelineEvents <- PipelineEvent{Type: KeyPhraseDetected, GuildId: guildId, VoiceChannelId: "voice", UserId: "user", Text: "hey lydia"}
+		pipelineEvents <- PipelineEvent{Type: CommandTranscribed, GuildId: guildId, VoiceChannelId: "voice", UserId: "user", Text: "play horn"}
+		ended := sessionEnded(guildId, "user", Idle, ResponseFinished)
+		ended.VoiceChannelId = "voice"
+		pipelineEvents <- ended
+	}
+	select {
+	case post := <-posted:
+		if post.textChannelId != "text2" {
+			t.Errorf("expected only guild2 to be mirrored got %q", post.textChannelId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was posted")
+	}
+	select {
+	case post := <-posted:
+		t.Errorf("expected guild1 to not be mirrored got %+v", post)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMirrorIgnoresLateEvents(t *testing.T) {
+	var config Config.Config
+	config.Discord.Guild = "guild"
+	config.Discord.TextChannel = "text"
+	config.Discord.Mirror.Enabled = true
+	pipelineEvents, posted := createMirrorTest(t, config)
+
+	started := PipelineEvent{
+		Type:       SessionStateChanged,
+		GuildId:    "guild",
+		UserId:     "user",
+		Text:       string(WakeDetected),
+		Transition: &SessionTransition{From: Idle, To: WakeDetected, Event: KeyPhraseHeard},
+	}
+	for _, event := range []PipelineEvent{
+		{Type: KeyPhraseDetected, GuildId: "guild", UserId: "user", Text: "hey lydia"},
+		started,
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play horn"},
+		sessionEnded("guild", "user", Idle, Cancelled),
+		//the cancelled sessions processing finishing after it was cancelled
+		{Type: RemoteBotResponded, GuildId: "guild", UserId: "user", Text: "playing horn"},
+		{Type: PushToTalkPressed, GuildId: "guild", UserId: "user"},
+		started,
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play fog horn"},
+		sessionEnded("guild", "user", Idle, TimedOut),
+	} {
+		pipelineEvents <- event
+	}
+
+	expected := []MirroredInteraction{
+		{GuildId: "guild", UserId: "user", KeyPhrase: "hey lydia", Transcript: "play horn", Ended: Cancelled},
+		{GuildId: "guild", UserId: "user", Transcript: "play fog horn", Ended: TimedOut},
+	}
+	received := make(map[string]MirroredInteraction)
+	for len(received) < len(expected) {
+		select {
+		case post := <-posted:
+			received[post.interaction.Transcript] = post.interaction
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only got %d interactions", len(received))
+		}
+	}
+	for _, interaction := range expected {
+		if received[interaction.Transcript] != interaction {
+			t.Errorf("expected %+v got %+v", interaction, received[interaction.Transcript])
+		}
+	}
+}
+
+func TestMirrorDropsRateLimitedKeyPhrase(t *testing.T) {
+	var config Config.Config
+	config.Discord.Guild = "guild"
+	config.Discord.TextChannel = "text"
+	config.Discord.Mirror.Enabled = true
+	pipelineEvents, posted := createMirrorTest(t, config)
+
+	for _, event := range []PipelineEvent{
+		{Type: KeyPhraseDetected, GuildId: "guild", UserId: "user", Text: "hey lydia"},
+		{Type: RateLimited, GuildId: "guild", UserId: "user", Text: "slow down"},
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play horn"},
+		//a follow up carries on without the key phrase being said again
+		{
+			Type:       SessionStateChanged,
+			GuildId:    "guild",
+			UserId:     "user",
+			Text:       string(Listening),
+			Transition: &SessionTransition{From: FollowUp, To: Listening, Event: ListeningStarted},
+		},
+		{Type: CommandTranscribed, GuildId: "guild", UserId: "user", Text: "play fog horn"},
+		sessionEnded("guild", "user", Idle, ResponseFinished),
+	} {
+		pipelineEvents <- event
+	}
+	expected := MirroredInteraction{GuildId: "guild", UserId: "user", Transcript: "play fog horn", Ended: ResponseFinished}
+	select {
+	case post := <-posted:
+		if post.interaction != expected {
+			t.Errorf("expected the cooldown to be left out of the next interaction %+v got %+v", expected, post.interaction)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was posted")
+	}
+}
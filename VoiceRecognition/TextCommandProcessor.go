@@ -0,0 +1,175 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"go.uber.org/zap"
+)
+
+//TextCommand is a command typed in a text channel instead of spoken
+type TextCommand struct {
+	GuildId       string
+	TextChannelId string
+	//VoiceChannelId is the voice channel the user is in, empty if they aren't in one
+	VoiceChannelId string
+	UserId         string
+	//Roles are the users role ids in the guild
+	Roles []string
+	Text  string
+	//Mentioned is true for messages mentioning the bot, they are only answered in the configured text channels
+	Mentioned bool
+	//Reply answers in the text channel the command was typed in
+	Reply func(message string)
+}
+
+//VoiceChannelSpeaker reads text out in a voice channel
+type VoiceChannelSpeaker interface {
+	Say(ctx context.Context, text string) error
+}
+
+//busyResponse is replied to a typed command while the users last one is still being answered
+const busyResponse = "still working on your last command"
+
+//answering is a variable so tests can swap in a scripted version that doesn't need rasa or a remote bot
+var answerTextCommand = textCommandProcessing
+
+type textCommandAnswered struct {
+	key         string
+	expectReply bool
+}
+
+//TextCommandProcessor answers typed commands through rasa and the remote bot the same way as spoken
+//ones. the answer is replied in text and read out too if the bot is in the users voice channel
+type TextCommandProcessor struct {
+	textCommands <-chan TextCommand
+	findSpeaker  func(guildId string, voiceChannelId string) VoiceChannelSpeaker
+	config       Config.Config
+	configNotify <-chan Config.Config
+	//conversations are kept by guild and user while the remote bot expects a reply
+	conversations map[string]*Conversation
+	//busy are the guild and users with a command being answered, they share a conversation so only one
+	//command is answered at a time
+	busy     map[string]bool
+	answered chan textCommandAnswered
+	close    chan chan bool
+	stopped  chan bool
+}
+
+//findSpeaker is the controller for the voice channel, or nil if the bot isn't in it
+func CreateTextCommandProcessor(textCommands <-chan TextCommand, findSpeaker func(guildId string, voiceChannelId string) VoiceChannelSpeaker, config Config.Config) *TextCommandProcessor {
+	p := &TextCommandProcessor{
+		textCommands:  textCommands,
+		findSpeaker:   findSpeaker,
+		config:        config,
+		configNotify:  Config.Subscribe(),
+		conversations: make(map[string]*Conversation),
+		busy:          make(map[string]bool),
+		answered:      make(chan textCommandAnswered),
+		close:         make(chan chan bool),
+		stopped:       make(chan bool),
+	}
+	go p.start()
+	return p
+}
+
+func (p *TextCommandProcessor) start() {
+	for {
+		select {
+		case command := <-p.textCommands:
+			if command.Mentioned && !textChannelConfigured(p.config, command.GuildId, command.TextChannelId) {
+				continue
+			}
+			key := command.GuildId + "/" + command.UserId
+			if p.busy[key] {
+				zap.S().Infof("user %s typed command \"%s\" while their last one was still being answered", command.UserId, command.Text)
+				go command.Reply(busyResponse)
+				continue
+			}
+			p.busy[key] = true
+			conversation, exists := p.conversations[key]
+			if !exists {
+				conversation = createConversation()
+				p.conversations[key] = conversation
+			}
+			session := &CommandSession{
+				userId:         command.UserId,
+				guildId:        command.GuildId,
+				voiceChannelId: command.VoiceChannelId,
+				conversation:   conversation,
+				roles: func() ([]string, error) {
+					return command.Roles, nil
+				},
+			}
+			go p.answer(key, command, session, p.config, p.findSpeaker(command.GuildId, command.VoiceChannelId))
+
+		case answered := <-p.answered:
+			delete(p.busy, answered.key)
+			if !answered.expectReply {
+				delete(p.conversations, answered.key)
+			}
+
+		case config := <-p.configNotify:
+			p.config = config
+
+		case complete := <-p.close:
+			Config.Unsubscribe(p.configNotify)
+			close(p.stopped)
+			complete <- true
+			return
+		}
+	}
+}
+
+//speaker is nil if the bot isn't in the users voice channel
+func (p *TextCommandProcessor) answer(key string, command TextCommand, session *CommandSession, config Config.Config, speaker VoiceChannelSpeaker) {
+	timeouts := sessionTimeoutsFromConfig(config)
+	zap.S().Infof("user %s typed command \"%s\"", command.UserId, command.Text)
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts[Understanding])
+	remoteBotResponse, response, err := answerTextCommand(ctx, session, command.Text, config)
+	cancel()
+	//the conversation is done with before replying so the user can type their next command straight away
+	if err != nil {
+		zap.S().Warn(err)
+		p.done(textCommandAnswered{key: key})
+		command.Reply("sorry something went wrong")
+		return
+	}
+	p.done(textCommandAnswered{key: key, expectReply: remoteBotResponse.ExpectReply})
+	command.Reply(response)
+	if speaker != nil && config.Commands.SpeakTyped {
+		ctx, cancel := context.WithTimeout(context.Background(), timeouts[Responding])
+		if err := speaker.Say(ctx, response); err != nil {
+			zap.S().Warnf("Failed to read out the response to a typed command: %s", err)
+		}
+		cancel()
+	}
+	callbackRemoteBot(remoteBotResponse)
+}
+
+func (p *TextCommandProcessor) done(answered textCommandAnswered) {
+	select {
+	case p.answered <- answered:
+	case <-p.stopped:
+	}
+}
+
+//typed commands don't go through the voice pipeline so there are no pipeline events to send
+func textCommandProcessing(ctx context.Context, session *CommandSession, command string, config Config.Config) (*RemoteBotResponse, string, error) {
+	return understandCommand(ctx, session, command, config, func(PipelineEvent) {})
+}
+
+func textChannelConfigured(config Config.Config, guildId string, textChannelId string) bool {
+	for _, channel := range config.DiscordChannels() {
+		if channel.Guild == guildId && channel.TextChannel == textChannelId {
+			return true
+		}
+	}
+	return false
+}
+
+//Close stops answering typed commands. answers already being worked out are still replied to
+func (p *TextCommandProcessor) Close() chan bool {
+	complete := make(chan bool)
+	p.close <- complete
+	return complete
+}
@@ -0,0 +1,162 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingSpeaker struct {
+	said chan string
+}
+
+func (rs *recordingSpeaker) Say(ctx context.Context, text string) error {
+	rs.said <- text
+	return nil
+}
+
+type answeredTextCommand struct {
+	session *CommandSession
+	command string
+}
+
+//answers every command with the response, asking for a reply if the command was expectReply
+func scriptedTextCommands(t *testing.T, response string) chan answeredTextCommand {
+	answered := make(chan answeredTextCommand, 10)
+	answerTextCommand = func(ctx context.Context, session *CommandSession, command string, config Config.Config) (*RemoteBotResponse, string, error) {
+		answered <- answeredTextCommand{session: session, command: command}
+		return &RemoteBotResponse{Text: response, Understood: true, ExpectReply: command == "expectReply"}, response, nil
+	}
+	t.Cleanup(func() {
+		answerTextCommand = textCommandProcessing
+	})
+	return answered
+}
+
+func createTextCommandTest(t *testing.T, config Config.Config, speaker VoiceChannelSpeaker) chan TextCommand {
+	textCommands := make(chan TextCommand)
+	findSpeaker := func(guildId string, voiceChannelId string) VoiceChannelSpeaker {
+		if voiceChannelId != "voice" {
+			return nil
+		}
+		return speaker
+	}
+	processor := CreateTextCommandProcessor(textCommands, findSpeaker, config)
+	t.Cleanup(func() {
+		<-processor.Close()
+	})
+	return textCommands
+}
+
+func typeCommand(t *testing.T, textCommands chan<- TextCommand, command TextCommand) string {
+	replies := make(chan string, 1)
+	command.Reply = func(message string) {
+		replies <- message
+	}
+	textCommands <- command
+	select {
+	case reply := <-replies:
+		return reply
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reply to %q", command.Text)
+	}
+	return ""
+}
+
+func TestTextCommandAnswered(t *testing.T) {
+	answered := scriptedTextCommands(t, "playing fog horn")
+	speaker := &recordingSpeaker{said: make(chan string, 1)}
+	config := testConfig(1)
+	config.Commands.SpeakTyped = true
+	textCommands := createTextCommandTest(t, config, speaker)
+
+	reply := typeCommand(t, textCommands, TextCommand{GuildId: "guild", VoiceChannelId: "voice", UserId: "user", Text: "play fog horn"})
+	if reply != "playing fog horn" {
+		t.Errorf("expected the remote bots response got %q", reply)
+	}
+	answer := <-answered
+	if answer.command != "play fog horn" || answer.session.userId != "user" || answer.session.guildId != "guild" || answer.session.voiceChannelId != "voice" {
+		t.Errorf("expected the command to come from the user and their voice channel got %q from %+v", answer.command, answer.session)
+	}
+	select {
+	case said := <-speaker.said:
+		if said != "playing fog horn" {
+			t.Errorf("expected the response to be read out got %q", said)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("response was not read out")
+	}
+}
+
+func TestMentionOnlyInTextChannel(t *testing.T) {
+	scriptedTextCommands(t, "ok")
+	config := testConfig(1)
+	config.Discord.Guild = "guild"
+	config.Discord.TextChannel = "text"
+	textCommands := createTextCommandTest(t, config, nil)
+
+	replies := make(chan string, 1)
+	textCommands <- TextCommand{GuildId: "guild", TextChannelId: "general", UserId: "user", Text: "play horn", Mentioned: true, Reply: func(message string) {
+		replies <- message
+	}}
+	if reply := typeCommand(t, textCommands, TextCommand{GuildId: "guild", TextChannelId: "text", UserId: "user", Text: "play horn", Mentioned: true}); reply != "ok" {
+		t.Errorf("expected a mention in the text channel to be answered got %q", reply)
+	}
+	select {
+	case reply := <-replies:
+		t.Errorf("expected a mention outside the text channel to be ignored got %q", reply)
+	default:
+	}
+}
+
+func TestTextCommandConversation(t *testing.T) {
+	answered := scriptedTextCommands(t, "which sound?")
+	textCommands := createTextCommandTest(t, testConfig(1), nil)
+
+	var conversations []*Conversation
+	for _, text := range []string{"expectReply", "fog", "play horn"} {
+		typeCommand(t, textCommands, TextCommand{GuildId: "guild", UserId: "user", Text: text})
+		conversations = append(conversations, (<-answered).session.conversation)
+	}
+	if conversations[0] != conversations[1] {
+		t.Errorf("expected the reply to continue the conversation")
+	}
+	if conversations[1] == conversations[2] {
+		t.Errorf("expected a new conversation once no reply was expected")
+	}
+}
+
+func TestTextCommandBackToBack(t *testing.T) {
+	answered := scriptedTextCommands(t, "playing fog horn")
+	release := make(chan bool)
+	scripted := answerTextCommand
+	answerTextCommand = func(ctx context.Context, session *CommandSession, command string, config Config.Config) (*RemoteBotResponse, string, error) {
+		<-release
+		return scripted(ctx, session, command, config)
+	}
+	textCommands := createTextCommandTest(t, testConfig(1), nil)
+
+	replies := make(chan string, 1)
+	textCommands <- TextCommand{GuildId: "guild", UserId: "user", Text: "play fog horn", Reply: func(message string) {
+		replies <- message
+	}}
+	if reply := typeCommand(t, textCommands, TextCommand{GuildId: "guild", UserId: "user", Text: "play air horn"}); reply != busyResponse {
+		t.Errorf("expected the second command to be turned away while the first is answered got %q", reply)
+	}
+	close(release)
+	select {
+	case reply := <-replies:
+		if reply != "playing fog horn" {
+			t.Errorf("expected the first command to be answered got %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first command was never answered")
+	}
+	if answer := <-answered; answer.command != "play fog horn" {
+		t.Errorf("expected only the first command to be answered got %q", answer.command)
+	}
+	if reply := typeCommand(t, textCommands, TextCommand{GuildId: "guild", UserId: "user", Text: "play air horn"}); reply != "playing fog horn" {
+		t.Errorf("expected the next command to be answered once the first was got %q", reply)
+	}
+}
@@ -0,0 +1,71 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"fmt"
+	"strings"
+)
+
+//TextToSpeech reads out the responses to commands
+type TextToSpeech interface {
+	//Synthesize returns a 16 bit pcm wave file of the text spoken at 48khz
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+}
+
+//CreateTextToSpeech creates the provider selected in the config with a cache in front of it
+//if a cache directory is set
+func CreateTextToSpeech(config Config.Config) (TextToSpeech, error) {
+	textToSpeech, err := createTextToSpeechProvider(config)
+	if err != nil || config.TextToSpeech.Cache.Directory == "" {
+		return textToSpeech, err
+	}
+	return CreateCachedTextToSpeech(textToSpeech, textToSpeechVoice(config), config.TextToSpeech.Cache.Directory, config.TextToSpeech.Cache.MaxSize*1024*1024)
+}
+
+//textToSpeechVoice is only the settings the provider in use reads so changing another providers
+//settings keeps the cache
+func textToSpeechVoice(config Config.Config) string {
+	switch config.TextToSpeech.Provider {
+	case "", "google":
+		return strings.Join([]string{"google", config.TextToSpeech.Language, config.TextToSpeech.Google.Voice}, "/")
+	case "espeak":
+		return strings.Join([]string{"espeak", config.TextToSpeech.Espeak.Voice}, "/")
+	case "piper":
+		return strings.Join([]string{"piper", config.TextToSpeech.Piper.Model}, "/")
+	default:
+		return config.TextToSpeech.Provider
+	}
+}
+
+func createTextToSpeechProvider(config Config.Config) (TextToSpeech, error) {
+	switch config.TextToSpeech.Provider {
+	case "", "google":
+		return &GoogleTextToSpeech{
+			LanguageCode:  config.TextToSpeech.Language,
+			Voice:         config.TextToSpeech.Google.Voice,
+			ClientOptions: GoogleClientOptions(config),
+		}, nil
+	case "espeak":
+		return &EspeakTextToSpeech{
+			Command: config.TextToSpeech.Espeak.Command,
+			Voice:   config.TextToSpeech.Espeak.Voice,
+		}, nil
+	case "piper":
+		return &PiperTextToSpeech{
+			Command: config.TextToSpeech.Piper.Command,
+			Model:   config.TextToSpeech.Piper.Model,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown text to speech provider %s", config.TextToSpeech.Provider)
+	}
+}
+
+//converts speech from providers that can't pick their sample rate to 48khz stereo
+func discordWave(speech *Wave) ([]byte, error) {
+	pcm, err := speech.discordPCM()
+	if err != nil {
+		return nil, err
+	}
+	return (&Wave{SampleRate: discordSampleRate, Channels: 2, PCM: pcm}).encode(), nil
+}
@@ -0,0 +1,183 @@
+package VoiceRecognition
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CachedTextToSpeech keeps synthesized responses on disk so phrases the remote bots say all the
+//time are only synthesized once. the least recently played responses are removed once the
+//cache is over its size limit
+type CachedTextToSpeech struct {
+	textToSpeech TextToSpeech
+	//voice identifies the provider and voice so changing either doesn't play old responses
+	voice     string
+	directory string
+	maxSize   int64
+	mutex     sync.Mutex
+	entries   map[string]*list.Element
+	//most recently used at the front
+	recent *list.List
+	size   int64
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+//CreateCachedTextToSpeech loads the responses already cached in directory. maxSize is in bytes
+func CreateCachedTextToSpeech(textToSpeech TextToSpeech, voice string, directory string, maxSize int64) (*CachedTextToSpeech, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	//the modified time is updated every time a response is played so it gives the order to evict in
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	ct := &CachedTextToSpeech{
+		textToSpeech: textToSpeech,
+		voice:        voice,
+		directory:    directory,
+		maxSize:      maxSize,
+		entries:      make(map[string]*list.Element),
+		recent:       list.New(),
+	}
+	for _, file := range files {
+		//a crash while storing leaves its temporary file behind
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".tmp" {
+			if err := os.Remove(filepath.Join(directory, file.Name())); err != nil && !os.IsNotExist(err) {
+				zap.S().Warnf("Could not remove partly cached response: %v", err)
+			}
+			continue
+		}
+		if file.IsDir() || filepath.Ext(file.Name()) != ".wav" {
+			continue
+		}
+		ct.entries[file.Name()] = ct.recent.PushBack(&cacheEntry{name: file.Name(), size: file.Size()})
+		ct.size += file.Size()
+	}
+	ct.mutex.Lock()
+	ct.evict()
+	ct.mutex.Unlock()
+	return ct, nil
+}
+
+func (ct *CachedTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	name := ct.fileName(text)
+	if wave, ok := ct.load(name); ok {
+		return wave, nil
+	}
+	wave, err := ct.textToSpeech.Synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if err := ct.store(name, wave); err != nil {
+		zap.S().Warnf("Could not cache response \"%s\": %v", text, err)
+	}
+	return wave, nil
+}
+
+//Prewarm synthesizes any of the phrases that aren't cached yet
+func (ct *CachedTextToSpeech) Prewarm(ctx context.Context, phrases []string) error {
+	for _, phrase := range phrases {
+		if _, err := ct.Synthesize(ctx, phrase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ct *CachedTextToSpeech) fileName(text string) string {
+	hash := sha256.Sum256([]byte(ct.voice + "\x00" + strings.TrimSpace(text)))
+	return hex.EncodeToString(hash[:]) + ".wav"
+}
+
+func (ct *CachedTextToSpeech) load(name string) ([]byte, bool) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	element, exists := ct.entries[name]
+	if !exists {
+		return nil, false
+	}
+	path := filepath.Join(ct.directory, name)
+	wave, err := ioutil.ReadFile(path)
+	if err != nil {
+		zap.S().Warnf("Could not read cached response %s: %v", name, err)
+		ct.remove(element)
+		return nil, false
+	}
+	ct.recent.MoveToFront(element)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return wave, true
+}
+
+//written to a temporary file first so a crash never leaves half a response in the cache
+func (ct *CachedTextToSpeech) store(name string, wave []byte) error {
+	if int64(len(wave)) > ct.maxSize {
+		return nil
+	}
+	file, err := ioutil.TempFile(ct.directory, "response-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(wave)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(ct.directory, name))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	if element, exists := ct.entries[name]; exists {
+		ct.size -= element.Value.(*cacheEntry).size
+		ct.recent.Remove(element)
+	}
+	ct.entries[name] = ct.recent.PushFront(&cacheEntry{name: name, size: int64(len(wave))})
+	ct.size += int64(len(wave))
+	ct.evict()
+	return nil
+}
+
+//must hold the mutex
+func (ct *CachedTextToSpeech) evict() {
+	for ct.size > ct.maxSize {
+		oldest := ct.recent.Back()
+		if oldest == nil {
+			return
+		}
+		if err := os.Remove(filepath.Join(ct.directory, oldest.Value.(*cacheEntry).name)); err != nil && !os.IsNotExist(err) {
+			zap.S().Warnf("Could not remove cached response: %v", err)
+		}
+		ct.remove(oldest)
+	}
+}
+
+//must hold the mutex
+func (ct *CachedTextToSpeech) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	delete(ct.entries, entry.name)
+	ct.size -= entry.size
+	ct.recent.Remove(element)
+}
@@ -0,0 +1,123 @@
+package VoiceRecognition
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//every phrase is synthesized as its own text so cache hits can be told apart
+type countingTextToSpeech struct {
+	synthesized []string
+}
+
+func (c *countingTextToSpeech) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	c.synthesized = append(c.synthesized, text)
+	return []byte(text), nil
+}
+
+func synthesize(t *testing.T, textToSpeech TextToSpeech, text string) {
+	wave, err := textToSpeech.Synthesize(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(wave) != text {
+		t.Errorf("expected \"%s\" got \"%s\"", text, wave)
+	}
+}
+
+func TestCachedTextToSpeechHits(t *testing.T) {
+	directory := t.TempDir()
+	provider := &countingTextToSpeech{}
+	cache, err := CreateCachedTextToSpeech(provider, "google/en-GB-Wavenet-A", directory, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Prewarm(context.Background(), []string{"sorry i didn't understand"}); err != nil {
+		t.Fatal(err)
+	}
+	synthesize(t, cache, "sorry i didn't understand")
+	synthesize(t, cache, "playing air horn")
+	synthesize(t, cache, "playing air horn")
+	if len(provider.synthesized) != 2 {
+		t.Errorf("expected 2 phrases synthesized got %v", provider.synthesized)
+	}
+
+	//a different voice must not play responses cached for the old one
+	otherVoice, err := CreateCachedTextToSpeech(provider, "espeak/en-gb", directory, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesize(t, otherVoice, "playing air horn")
+	if len(provider.synthesized) != 3 {
+		t.Errorf("expected the new voice to be synthesized got %v", provider.synthesized)
+	}
+
+	//the cache lives on after a restart
+	restarted, err := CreateCachedTextToSpeech(provider, "google/en-GB-Wavenet-A", directory, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesize(t, restarted, "playing air horn")
+	if len(provider.synthesized) != 3 {
+		t.Errorf("expected the cached response after restarting got %v", provider.synthesized)
+	}
+}
+
+func TestCachedTextToSpeechEvictsLeastRecentlyUsed(t *testing.T) {
+	provider := &countingTextToSpeech{}
+	//room for two of the ten byte phrases
+	cache, err := CreateCachedTextToSpeech(provider, "voice", t.TempDir(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synthesize(t, cache, "phrase one")
+	synthesize(t, cache, "phrase two")
+	synthesize(t, cache, "phrase one")
+	synthesize(t, cache, "phrase 3!!")
+	provider.synthesized = nil
+
+	synthesize(t, cache, "phrase one")
+	synthesize(t, cache, "phrase 3!!")
+	if len(provider.synthesized) != 0 {
+		t.Errorf("expected recently used phrases to be cached got %v synthesized", provider.synthesized)
+	}
+	synthesize(t, cache, "phrase two")
+	if len(provider.synthesized) != 1 {
+		t.Errorf("expected the least recently used phrase to be evicted got %v synthesized", provider.synthesized)
+	}
+}
+
+func TestCachedTextToSpeechRemovesTemporaryFiles(t *testing.T) {
+	directory := t.TempDir()
+	leftover := filepath.Join(directory, "response-123.tmp")
+	if err := ioutil.WriteFile(leftover, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateCachedTextToSpeech(&countingTextToSpeech{}, "voice", directory, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file to be removed got %v", err)
+	}
+}
+
+func TestTextToSpeechVoice(t *testing.T) {
+	var config Config.Config
+	config.TextToSpeech.Language = "en-GB"
+	config.TextToSpeech.Google.Voice = "en-GB-Wavenet-A"
+	defaultProvider := textToSpeechVoice(config)
+	config.TextToSpeech.Provider = "google"
+	config.TextToSpeech.Espeak.Voice = "en-gb"
+	config.TextToSpeech.Piper.Model = "model.onnx"
+	if voice := textToSpeechVoice(config); voice != defaultProvider {
+		t.Errorf("expected google to be cached the same whether it is set or the default got %q and %q", voice, defaultProvider)
+	}
+	config.TextToSpeech.Google.Voice = "en-GB-Wavenet-B"
+	if textToSpeechVoice(config) == defaultProvider {
+		t.Error("expected a new google voice to be cached separately")
+	}
+}
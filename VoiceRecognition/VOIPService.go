@@ -1 +1,45 @@
 package VoiceRecognition
+
+//VoicePacket is a single opus frame received from one speaker in the voice channel
+type VoicePacket struct {
+	SSRC uint32
+	Opus []byte
+}
+
+//Speaker links the ssrc of an inbound voice stream to the user it belongs to
+type Speaker struct {
+	SSRC   uint32
+	UserId string
+}
+
+//VOIPUser is what the controller needs to know about a user of the voip service
+type VOIPUser struct {
+	Id       string
+	Username string
+	Bot      bool
+	//Roles are the users role ids in the guild
+	Roles []string
+}
+
+//VOIPService is the voice platform the controller listens and talks through.
+//discord is the only real one at the moment but anything that can give per speaker
+//opus streams and accept opus frames to play back can be plugged in.
+type VOIPService interface {
+	//Join connects to the voice channel. the channels below are only live after joining
+	Join(guildId string, channelId string) error
+	//Leave disconnects from the voice channel but keeps the service connection open
+	Leave() error
+	//Close leaves the voice channel if joined and shuts down the service connection unless
+	//it is shared with other channels
+	Close() error
+	//OpusRecv is every opus packet received from every speaker in the voice channel
+	OpusRecv() <-chan *VoicePacket
+	//OpusSend plays opus frames in the voice channel. frames are 20ms 48khz stereo
+	OpusSend() chan<- []byte
+	Speaking(speaking bool) error
+	//SpeakerConnect notifies when a speakers ssrc is first known
+	SpeakerConnect() <-chan Speaker
+	//SpeakerDisconnect notifies with the user id of a user that left voice
+	SpeakerDisconnect() <-chan string
+	User(userId string) (*VOIPUser, error)
+}
@@ -1,24 +1,39 @@
 package VoiceRecognition
 
+import "go.uber.org/zap"
+
 type VoiceChannelUser struct {
-	userId               string
-	ssrc                 uint32
+	userId string
+	ssrc   uint32
+	//keyPhraseRecognition is nil for users that push to talk
 	keyPhraseRecognition *KeyPhraseRecognition
 	silenceFrames        int
 	speaking             bool
 }
 
-func createVoiceChannelUser(userId string, ssrc uint32, keywordSpokenNotify chan KeywordSpokenNotify, silenceFrames int) (*VoiceChannelUser, error) {
-	keyPhraseRecognition, err := createKeyPhraseRecognition(keywordSpokenNotify)
+func createVoiceChannelUser(userId string, ssrc uint32, keywordSpokenNotify chan KeywordSpokenNotify, silenceFrames int, wakeWord bool) (*VoiceChannelUser, error) {
+	voiceChannelUser := &VoiceChannelUser{
+		userId:        userId,
+		ssrc:          ssrc,
+		silenceFrames: silenceFrames,
+	}
+	if !wakeWord {
+		return voiceChannelUser, nil
+	}
+	keyPhraseRecognition, err := newKeyPhraseRecognition(keywordSpokenNotify)
 	if err != nil {
 		return nil, err
 	}
-	return &VoiceChannelUser{
-		userId:               userId,
-		ssrc:                 ssrc,
-		keyPhraseRecognition: keyPhraseRecognition,
-		silenceFrames:        silenceFrames,
-	}, nil
+	voiceChannelUser.keyPhraseRecognition = keyPhraseRecognition
+	return voiceChannelUser, nil
+}
+
+//stopKeyPhraseRecognition is safe to call for users without it
+func (vcu *VoiceChannelUser) stopKeyPhraseRecognition() {
+	if vcu.keyPhraseRecognition != nil {
+		close(vcu.keyPhraseRecognition.VoiceInfoRecv)
+		vcu.keyPhraseRecognition = nil
+	}
 }
 
 type VoiceChannelUsers struct {
@@ -33,8 +48,9 @@ func createVoiceChannelUsers() *VoiceChannelUsers {
 	}
 }
 
-func (vcus *VoiceChannelUsers) add(userId string, ssrc uint32, keywordSpokenNotify chan KeywordSpokenNotify, silenceFrames int) error {
-	voiceChannelUser, err := createVoiceChannelUser(userId, ssrc, keywordSpokenNotify, silenceFrames)
+//wakeWord is false for users that push to talk so they don't get key phrase recognition
+func (vcus *VoiceChannelUsers) add(userId string, ssrc uint32, keywordSpokenNotify chan KeywordSpokenNotify, silenceFrames int, wakeWord bool) error {
+	voiceChannelUser, err := createVoiceChannelUser(userId, ssrc, keywordSpokenNotify, silenceFrames, wakeWord)
 	if err != nil {
 		return err
 	}
@@ -48,7 +64,29 @@ func (vcus *VoiceChannelUsers) remove(userId string) {
 	if !exists {
 		return
 	}
-	close(voiceChannelUser.keyPhraseRecognition.VoiceInfoRecv)
+	voiceChannelUser.stopKeyPhraseRecognition()
 	delete(vcus.bySSRC, voiceChannelUser.ssrc)
 	delete(vcus.byUserId, userId)
 }
+
+//reloadKeyPhraseRecognition starts key phrase recognition for users that now use the wake word and stops
+//it for users that now push to talk. rebuild replaces everyone elses too so sphinx picks up new settings,
+//decoders are slow to make so it is only done when sphinx changed. anyone it fails for keeps what they had
+func (vcus *VoiceChannelUsers) reloadKeyPhraseRecognition(keywordSpokenNotify chan KeywordSpokenNotify, wakeWord func(userId string) bool, rebuild bool) {
+	for _, voiceChannelUser := range vcus.byUserId {
+		if !wakeWord(voiceChannelUser.userId) {
+			voiceChannelUser.stopKeyPhraseRecognition()
+			continue
+		}
+		if voiceChannelUser.keyPhraseRecognition != nil && !rebuild {
+			continue
+		}
+		keyPhraseRecognition, err := newKeyPhraseRecognition(keywordSpokenNotify)
+		if err != nil {
+			zap.S().Warnf("Failed to reload key phrase recognition for user %s: %s", voiceChannelUser.userId, err)
+			continue
+		}
+		voiceChannelUser.stopKeyPhraseRecognition()
+		voiceChannelUser.keyPhraseRecognition = keyPhraseRecognition
+	}
+}
@@ -0,0 +1,117 @@
+//go:build vosk
+// +build vosk
+
+package VoiceRecognition
+
+import (
+	vosk "github.com/alphacep/vosk-api/go"
+	"sync"
+)
+
+//models take a while to load and use a lot of memory so each one is only loaded once
+var voskModels = struct {
+	sync.Mutex
+	byPath map[string]*vosk.VoskModel
+}{byPath: make(map[string]*vosk.VoskModel)}
+
+type voskLocalStream struct {
+	recognizer  *vosk.VoskRecognizer
+	downsampler pcmDownsampleBuffer
+	transcripts chan Transcript
+	finished    bool
+}
+
+func loadVoskModel(modelPath string) (*vosk.VoskModel, error) {
+	voskModels.Lock()
+	defer voskModels.Unlock()
+	if model, exists := voskModels.byPath[modelPath]; exists {
+		return model, nil
+	}
+	model, err := vosk.NewModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	voskModels.byPath[modelPath] = model
+	return model, nil
+}
+
+func startLocalVoskStream(modelPath string) (SpeechToTextStream, error) {
+	model, err := loadVoskModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	recognizer, err := vosk.NewRecognizer(model, voskSampleRate)
+	if err != nil {
+		return nil, err
+	}
+	recognizer.SetWords(1)
+	return &voskLocalStream{
+		recognizer:  recognizer,
+		transcripts: make(chan Transcript, 100),
+	}, nil
+}
+
+//recognition happens as the audio is sent so there is nothing running in the background
+func (vl *voskLocalStream) SendPCM(pcm []int16) error {
+	if vl.finished {
+		return nil
+	}
+	monoPCM, err := vl.downsampler.push(pcm)
+	if err != nil || len(monoPCM) == 0 {
+		return err
+	}
+	pcmBytes, err := int16SliceToByteSlice(monoPCM)
+	if err != nil {
+		return err
+	}
+	if vl.recognizer.AcceptWaveform(pcmBytes) == 0 {
+		if transcript, ok := parseVoskResult(vl.recognizer.PartialResult()); ok {
+			select {
+			case vl.transcripts <- transcript:
+			default:
+			}
+		}
+		return nil
+	}
+	if transcript, ok := parseVoskResult(vl.recognizer.Result()); ok {
+		vl.transcripts <- transcript
+		vl.finish()
+	}
+	return nil
+}
+
+func (vl *voskLocalStream) Transcripts() <-chan Transcript {
+	return vl.transcripts
+}
+
+func (vl *voskLocalStream) Err() error {
+	return nil
+}
+
+func (vl *voskLocalStream) Close() error {
+	if vl.finished {
+		return nil
+	}
+	monoPCM, err := vl.downsampler.flush()
+	if err != nil {
+		vl.finish()
+		return err
+	}
+	if len(monoPCM) > 0 {
+		pcmBytes, err := int16SliceToByteSlice(monoPCM)
+		if err == nil {
+			vl.recognizer.AcceptWaveform(pcmBytes)
+		}
+	}
+	if transcript, ok := parseVoskResult(vl.recognizer.FinalResult()); ok {
+		vl.transcripts <- transcript
+	}
+	vl.finish()
+	return nil
+}
+
+func (vl *voskLocalStream) finish() {
+	vl.finished = true
+	vl.recognizer.Free()
+	close(vl.transcripts)
+}
@@ -0,0 +1,10 @@
+//go:build !vosk
+// +build !vosk
+
+package VoiceRecognition
+
+import "errors"
+
+func startLocalVoskStream(modelPath string) (SpeechToTextStream, error) {
+	return nil, errors.New("loading a vosk model needs libvosk, rebuild with -tags vosk or use a vosk server")
+}
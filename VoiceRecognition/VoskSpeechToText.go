@@ -0,0 +1,165 @@
+package VoiceRecognition
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+//vosk models are trained on 16khz mono audio
+const voskSampleRate = sphinxSampleRate
+
+//VoskSpeechToText recognises commands offline with vosk (kaldi). either a model is loaded
+//into the process or audio is streamed to a vosk server running locally.
+//loading a model in process needs libvosk and building with -tags vosk
+type VoskSpeechToText struct {
+	//ModelPath is the directory of a vosk model to load in process. takes priority over ServerURL
+	ModelPath string
+	//ServerURL is the websocket address of a vosk server e.g. ws://127.0.0.1:2700
+	ServerURL string
+}
+
+//a result is either a partial or a final text. words only have confidence when the server
+//is started with word output enabled
+type voskResult struct {
+	Partial string  `json:"partial"`
+	Text    *string `json:"text"`
+	Result  []struct {
+		Word       string  `json:"word"`
+		Confidence float32 `json:"conf"`
+	} `json:"result"`
+}
+
+type voskServerStream struct {
+	connection  *websocket.Conn
+	downsampler pcmDownsampleBuffer
+	transcripts chan Transcript
+	err         error
+	closed      bool
+}
+
+func (v *VoskSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	if v.ModelPath != "" {
+		return startLocalVoskStream(v.ModelPath)
+	}
+	if v.ServerURL == "" {
+		return nil, errors.New("vosk needs either a model path or a server url")
+	}
+	connection, _, err := websocket.DefaultDialer.DialContext(ctx, v.ServerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = connection.WriteJSON(map[string]interface{}{
+		"config": map[string]interface{}{"sample_rate": voskSampleRate},
+	})
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	vs := &voskServerStream{
+		connection:  connection,
+		transcripts: make(chan Transcript, 100),
+	}
+	go vs.readResponse()
+	return vs, nil
+}
+
+func (vs *voskServerStream) SendPCM(pcm []int16) error {
+	if vs.closed {
+		return nil
+	}
+	monoPCM, err := vs.downsampler.push(pcm)
+	if err != nil || len(monoPCM) == 0 {
+		return err
+	}
+	return vs.sendMonoPCM(monoPCM)
+}
+
+func (vs *voskServerStream) sendMonoPCM(monoPCM []int16) error {
+	pcmBytes, err := int16SliceToByteSlice(monoPCM)
+	if err != nil {
+		return err
+	}
+	return vs.connection.WriteMessage(websocket.BinaryMessage, pcmBytes)
+}
+
+func (vs *voskServerStream) Transcripts() <-chan Transcript {
+	return vs.transcripts
+}
+
+func (vs *voskServerStream) Err() error {
+	return vs.err
+}
+
+//sending eof makes the server send the final result for whatever audio it has then hang up
+func (vs *voskServerStream) Close() error {
+	if vs.closed {
+		return nil
+	}
+	vs.closed = true
+	monoPCM, err := vs.downsampler.flush()
+	if err != nil {
+		zap.S().Infof("Failed to downsample remaining audio for vosk: %s", err)
+	} else if len(monoPCM) > 0 {
+		if err := vs.sendMonoPCM(monoPCM); err != nil {
+			return err
+		}
+	}
+	return vs.connection.WriteMessage(websocket.TextMessage, []byte(`{"eof" : 1}`))
+}
+
+func (vs *voskServerStream) readResponse() {
+	defer close(vs.transcripts)
+	defer vs.connection.Close()
+	for {
+		result := voskResult{}
+		if err := vs.connection.ReadJSON(&result); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				vs.err = err
+			}
+			return
+		}
+		transcript, ok := result.transcript()
+		if !ok {
+			continue
+		}
+		if !transcript.Final {
+			//interim results are only informational so they are dropped if no one is keeping up
+			select {
+			case vs.transcripts <- transcript:
+			default:
+			}
+			continue
+		}
+		vs.transcripts <- transcript
+	}
+}
+
+//vosk sends an empty final result each time it hears silence which isn't a command
+func (r voskResult) transcript() (Transcript, bool) {
+	if r.Text == nil {
+		return Transcript{Text: r.Partial}, r.Partial != ""
+	}
+	if *r.Text == "" {
+		return Transcript{}, false
+	}
+	transcript := Transcript{Text: *r.Text, Final: true}
+	if len(r.Result) > 0 {
+		for _, word := range r.Result {
+			transcript.Confidence += word.Confidence
+		}
+		transcript.Confidence /= float32(len(r.Result))
+	}
+	return transcript, true
+}
+
+func parseVoskResult(resultJson string) (Transcript, bool) {
+	result := voskResult{}
+	if err := json.Unmarshal([]byte(resultJson), &result); err != nil {
+		zap.S().Infof("Failed to parse vosk result: %s", err)
+		return Transcript{}, false
+	}
+	return result.transcript()
+}
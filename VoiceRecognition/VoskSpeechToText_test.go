@@ -0,0 +1,109 @@
+package VoiceRecognition
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//answers like a vosk server would. a partial for every chunk of audio and the final text on eof
+func fakeVoskServer(t *testing.T, finalText string, sampleRate chan<- float64) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connection, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer connection.Close()
+		for {
+			messageType, message, err := connection.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				connection.WriteMessage(websocket.TextMessage, []byte(`{"partial" : "play"}`))
+				continue
+			}
+			if strings.Contains(string(message), "config") {
+				var config struct {
+					Config struct {
+						SampleRate float64 `json:"sample_rate"`
+					} `json:"config"`
+				}
+				if err := json.Unmarshal(message, &config); err != nil {
+					t.Error(err)
+				}
+				sampleRate <- config.Config.SampleRate
+				continue
+			}
+			connection.WriteMessage(websocket.TextMessage, []byte(`{"result" : [{"conf" : 1.0, "word" : "play"}, {"conf" : 0.5, "word" : "horn"}], "text" : "`+finalText+`"}`))
+			connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}))
+}
+
+func TestVoskServerTranscript(t *testing.T) {
+	sampleRate := make(chan float64, 1)
+	server := fakeVoskServer(t, "play horn", sampleRate)
+	defer server.Close()
+
+	vosk := &VoskSpeechToText{ServerURL: "ws" + strings.TrimPrefix(server.URL, "http")}
+	stream, err := vosk.StartStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := <-sampleRate; rate != voskSampleRate {
+		t.Errorf("expected sample rate %d got %f", voskSampleRate, rate)
+	}
+	for i := 0; i < 10; i++ {
+		if err := stream.SendPCM(make([]int16, frameSizeStereo)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var final *Transcript
+	for transcript := range stream.Transcripts() {
+		if transcript.Final {
+			finalTranscript := transcript
+			final = &finalTranscript
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Error(err)
+	}
+	if final == nil {
+		t.Fatal("no final transcript")
+	}
+	if final.Text != "play horn" || final.Confidence != 0.75 {
+		t.Errorf("unexpected final transcript %+v", final)
+	}
+}
+
+func TestVoskServerSilenceIsNotACommand(t *testing.T) {
+	sampleRate := make(chan float64, 1)
+	server := fakeVoskServer(t, "", sampleRate)
+	defer server.Close()
+
+	vosk := &VoskSpeechToText{ServerURL: "ws" + strings.TrimPrefix(server.URL, "http")}
+	stream, err := vosk.StartStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for transcript := range stream.Transcripts() {
+		if transcript.Final {
+			t.Errorf("unexpected final transcript %+v", transcript)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package VoiceRecognition
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"layeh.com/gopus"
+)
+
+type Wave struct {
+	SampleRate int
+	Channels   int
+	PCM        []int16
+}
+
+//reads a 16 bit pcm wave file. walks the riff chunks instead of assuming a 44 byte header
+//since files saved by most editors have extra chunks like LIST before the data
+func decodeWave(wave []byte) (*Wave, error) {
+	if len(wave) < 12 || string(wave[0:4]) != "RIFF" || string(wave[8:12]) != "WAVE" {
+		return nil, errors.New("not a riff wave file")
+	}
+	w := &Wave{}
+	formatFound := false
+	for offset := 12; offset+8 <= len(wave); {
+		chunkId := string(wave[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(wave[offset+4 : offset+8]))
+		chunkStart := offset + 8
+		chunkEnd := chunkStart + chunkSize
+		if chunkEnd > len(wave) {
+			chunkEnd = len(wave)
+		}
+		switch chunkId {
+		case "fmt ":
+			if chunkEnd-chunkStart < 16 {
+				return nil, errors.New("wave fmt chunk too short")
+			}
+			audioFormat := binary.LittleEndian.Uint16(wave[chunkStart : chunkStart+2])
+			bitsPerSample := binary.LittleEndian.Uint16(wave[chunkStart+14 : chunkStart+16])
+			if audioFormat != 1 || bitsPerSample != 16 {
+				return nil, fmt.Errorf("unsupported wave format %d with %d bits per sample only 16 bit pcm is supported", audioFormat, bitsPerSample)
+			}
+			w.Channels = int(binary.LittleEndian.Uint16(wave[chunkStart+2 : chunkStart+4]))
+			w.SampleRate = int(binary.LittleEndian.Uint32(wave[chunkStart+4 : chunkStart+8]))
+			formatFound = true
+		case "data":
+			if !formatFound {
+				return nil, errors.New("wave data chunk before fmt chunk")
+			}
+			//drop a trailing odd byte if the file was cut short
+			data := wave[chunkStart:chunkEnd]
+			pcm, err := byteSliceToInt16Slice(data[:len(data)-len(data)%2])
+			if err != nil {
+				return nil, err
+			}
+			w.PCM = pcm
+			return w, nil
+		}
+		//chunks are padded to an even size
+		offset = chunkStart + chunkSize + chunkSize%2
+	}
+	return nil, errors.New("wave file has no data chunk")
+}
+
+//converts the wave to the 48khz stereo pcm discord sends and receives
+func (w *Wave) discordPCM() ([]int16, error) {
+	pcm := w.PCM
+	switch w.Channels {
+	case 1:
+		pcm = convertMonoToStero(pcm)
+	case 2:
+	default:
+		return nil, fmt.Errorf("unsupported wave channel count %d", w.Channels)
+	}
+	if w.SampleRate == discordSampleRate {
+		return pcm, nil
+	}
+	return resamplePCMRate(pcm, 2, w.SampleRate, discordSampleRate)
+}
+
+//encodes the wave as a 16 bit pcm wave file with just the fmt and data chunks
+func (w *Wave) encode() []byte {
+	const headerSize = 44
+	dataSize := len(w.PCM) * 2
+	wave := make([]byte, headerSize, headerSize+dataSize)
+	copy(wave[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(wave[4:8], uint32(headerSize-8+dataSize))
+	copy(wave[8:16], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wave[16:20], 16)
+	binary.LittleEndian.PutUint16(wave[20:22], 1)
+	binary.LittleEndian.PutUint16(wave[22:24], uint16(w.Channels))
+	binary.LittleEndian.PutUint32(wave[24:28], uint32(w.SampleRate))
+	binary.LittleEndian.PutUint32(wave[28:32], uint32(w.SampleRate*w.Channels*2))
+	binary.LittleEndian.PutUint16(wave[32:34], uint16(w.Channels*2))
+	binary.LittleEndian.PutUint16(wave[34:36], 16)
+	copy(wave[36:40], "data")
+	binary.LittleEndian.PutUint32(wave[40:44], uint32(dataSize))
+	for _, sample := range w.PCM {
+		wave = append(wave, byte(sample), byte(sample>>8))
+	}
+	return wave
+}
+
+//encodes a wave file to the 20ms opus frames discord would send for it
+func waveToOpusFrames(wave []byte) ([][]byte, error) {
+	decodedWave, err := decodeWave(wave)
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := decodedWave.discordPCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) == 0 {
+		return nil, nil
+	}
+	opusEncoder, err := gopus.NewEncoder(discordSampleRate, 2, gopus.Audio)
+	if err != nil {
+		return nil, err
+	}
+	pcmFrames := pcmSliceToPCMFrameSlice(pcm)
+	opusFrames := make([][]byte, 0, len(pcmFrames))
+	for _, pcmFrame := range pcmFrames {
+		opusFrame, err := encodePCMFrameToOpusBytes(pcmFrame, opusEncoder)
+		if err != nil {
+			return nil, err
+		}
+		opusFrames = append(opusFrames, opusFrame)
+	}
+	return opusFrames, nil
+}
@@ -0,0 +1,83 @@
+//go:build whisper
+// +build whisper
+
+package VoiceRecognition
+
+import (
+	"github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
+	"io"
+	"strings"
+	"sync"
+)
+
+//models take a while to load and use a lot of memory so each one is only loaded once
+var whisperModels = struct {
+	sync.Mutex
+	byPath map[string]whisper.Model
+}{byPath: make(map[string]whisper.Model)}
+
+func loadWhisperModel(modelPath string) error {
+	_, err := getWhisperModel(modelPath)
+	return err
+}
+
+func getWhisperModel(modelPath string) (whisper.Model, error) {
+	whisperModels.Lock()
+	defer whisperModels.Unlock()
+	if model, exists := whisperModels.byPath[modelPath]; exists {
+		return model, nil
+	}
+	model, err := whisper.New(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	whisperModels.byPath[modelPath] = model
+	return model, nil
+}
+
+//pcm is 16khz mono. each segments confidence is the average probability of its tokens
+func transcribeWithWhisper(modelPath string, language string, threads int, pcm []float32) ([]TranscriptSegment, error) {
+	model, err := getWhisperModel(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	//contexts aren't safe to share so every command gets its own
+	whisperContext, err := model.NewContext()
+	if err != nil {
+		return nil, err
+	}
+	if language != "" {
+		if err := whisperContext.SetLanguage(language); err != nil {
+			return nil, err
+		}
+	}
+	if threads > 0 {
+		whisperContext.SetThreads(uint(threads))
+	}
+	if err := whisperContext.Process(pcm, nil, nil, nil); err != nil {
+		return nil, err
+	}
+	var segments []TranscriptSegment
+	for {
+		segment, err := whisperContext.NextSegment()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		transcriptSegment := TranscriptSegment{
+			Text:  strings.TrimSpace(segment.Text),
+			Start: segment.Start,
+			End:   segment.End,
+		}
+		for _, token := range segment.Tokens {
+			transcriptSegment.Confidence += token.P
+		}
+		if len(segment.Tokens) > 0 {
+			transcriptSegment.Confidence /= float32(len(segment.Tokens))
+		}
+		segments = append(segments, transcriptSegment)
+	}
+	return segments, nil
+}
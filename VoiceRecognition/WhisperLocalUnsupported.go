@@ -0,0 +1,16 @@
+//go:build !whisper
+// +build !whisper
+
+package VoiceRecognition
+
+import "errors"
+
+var errWhisperUnsupported = errors.New("whisper needs libwhisper, rebuild with -tags whisper")
+
+func loadWhisperModel(modelPath string) error {
+	return errWhisperUnsupported
+}
+
+func transcribeWithWhisper(modelPath string, language string, threads int, pcm []float32) ([]TranscriptSegment, error) {
+	return nil, errWhisperUnsupported
+}
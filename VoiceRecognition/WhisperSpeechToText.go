@@ -0,0 +1,157 @@
+package VoiceRecognition
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+//how many 20ms frames the user has to stay quiet after discord says they stopped speaking
+//before the command is transcribed. stops short pauses mid command cutting it in half
+const whisperEndpointSilenceFrames = 30
+
+//WhisperSpeechToText transcribes commands on the cpu with whisper.cpp. whisper works on whole
+//utterances rather than streams so the command is buffered until the user stops speaking.
+//needs libwhisper and building with -tags whisper
+type WhisperSpeechToText struct {
+	//ModelPath is a ggml whisper model file
+	ModelPath string
+	//Language is a two letter language code. empty lets whisper detect it
+	Language string
+	//Threads defaults to whatever whisper.cpp picks if zero
+	Threads int
+}
+
+type whisperStream struct {
+	whisper      *WhisperSpeechToText
+	downsampler  pcmDownsampleBuffer
+	pcm          []float32
+	speaking     bool
+	heardSpeech  bool
+	silentFrames int
+	finished     bool
+	transcripts  chan Transcript
+	err          error
+}
+
+func (w *WhisperSpeechToText) StartStream(ctx context.Context) (SpeechToTextStream, error) {
+	if w.ModelPath == "" {
+		return nil, errors.New("whisper needs a model path")
+	}
+	//loading the model up front means a bad model fails the command straight away
+	if err := loadWhisperModel(w.ModelPath); err != nil {
+		return nil, err
+	}
+	return &whisperStream{
+		whisper:     w,
+		transcripts: make(chan Transcript, 1),
+	}, nil
+}
+
+func (ws *whisperStream) SpeakingChanged(speaking bool) {
+	ws.speaking = speaking
+	if speaking {
+		ws.heardSpeech = true
+		ws.silentFrames = 0
+	}
+}
+
+//audio before the user starts speaking is silence from the ticker so it isn't kept
+func (ws *whisperStream) SendPCM(pcm []int16) error {
+	if ws.finished || !ws.heardSpeech {
+		return nil
+	}
+	if err := ws.buffer(ws.downsampler.push(pcm)); err != nil {
+		return err
+	}
+	if ws.speaking {
+		return nil
+	}
+	ws.silentFrames++
+	if ws.silentFrames >= whisperEndpointSilenceFrames {
+		ws.finish()
+	}
+	return nil
+}
+
+func (ws *whisperStream) Transcripts() <-chan Transcript {
+	return ws.transcripts
+}
+
+func (ws *whisperStream) Err() error {
+	return ws.err
+}
+
+func (ws *whisperStream) Close() error {
+	if !ws.finished {
+		ws.finish()
+	}
+	return nil
+}
+
+func (ws *whisperStream) buffer(monoPCM []int16, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, sample := range monoPCM {
+		ws.pcm = append(ws.pcm, float32(sample)/32768)
+	}
+	return nil
+}
+
+//transcribing takes a while so it is done in the background to keep the voice flowing
+func (ws *whisperStream) finish() {
+	ws.finished = true
+	if err := ws.buffer(ws.downsampler.flush()); err != nil {
+		ws.err = err
+		close(ws.transcripts)
+		return
+	}
+	pcm := ws.pcm
+	ws.pcm = nil
+	go func() {
+		defer close(ws.transcripts)
+		if len(pcm) == 0 {
+			return
+		}
+		segments, err := transcribeWithWhisper(ws.whisper.ModelPath, ws.whisper.Language, ws.whisper.Threads, pcm)
+		if err != nil {
+			ws.err = err
+			return
+		}
+		transcript := transcriptFromSegments(segments)
+		if transcript.Text == "" {
+			return
+		}
+		ws.transcripts <- transcript
+	}()
+}
+
+//the transcript confidence is the average of the segments
+func transcriptFromSegments(segments []TranscriptSegment) Transcript {
+	transcript := Transcript{Final: true}
+	var texts []string
+	for _, segment := range segments {
+		if isWhisperNonSpeech(segment.Text) {
+			continue
+		}
+		texts = append(texts, segment.Text)
+		transcript.Segments = append(transcript.Segments, segment)
+		transcript.Confidence += segment.Confidence
+	}
+	if len(transcript.Segments) > 0 {
+		transcript.Confidence /= float32(len(transcript.Segments))
+	}
+	transcript.Text = strings.Join(texts, " ")
+	return transcript
+}
+
+//whisper writes things like [BLANK_AUDIO] or (music) when it hears something that isn't speech
+func isWhisperNonSpeech(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return true
+	}
+	return (strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")) ||
+		(strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")"))
+}
@@ -0,0 +1,21 @@
+package VoiceRecognition
+
+import "testing"
+
+func TestTranscriptFromSegmentsSkipsNonSpeech(t *testing.T) {
+	transcript := transcriptFromSegments([]TranscriptSegment{
+		{Text: "[BLANK_AUDIO]", Confidence: 0.1},
+		{Text: "play fog", Confidence: 0.9},
+		{Text: "horn", Confidence: 0.5},
+		{Text: "(music)", Confidence: 0.2},
+	})
+	if transcript.Text != "play fog horn" {
+		t.Errorf("unexpected transcript text \"%s\"", transcript.Text)
+	}
+	if len(transcript.Segments) != 2 || transcript.Confidence != 0.7 {
+		t.Errorf("unexpected segments %+v with confidence %f", transcript.Segments, transcript.Confidence)
+	}
+	if !transcript.Final {
+		t.Error("whisper transcripts are always final")
+	}
+}
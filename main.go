@@ -4,69 +4,199 @@ import (
 	"DiscordVoiceRecognition/Config"
 	"DiscordVoiceRecognition/RasaNLU"
 	"DiscordVoiceRecognition/VoiceRecognition"
-	"encoding/json"
+	"context"
+	"flag"
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-func main() {
-	//login and configuration setup
-	config := Config.LoadConfig()
+//how often the config file is checked for changes
+const configWatchInterval = 5 * time.Second
 
-	logConfig := zap.NewDevelopmentConfig()
-	logConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	logConfig.OutputPaths = []string{
-		"stderr",
-		config.Log.Path,
+func main() {
+	configPath := flag.String("config", "", "config file, defaults to $"+Config.PathEnvironmentVariable+" or "+Config.DefaultPath)
+	flag.Parse()
+	if *configPath != "" {
+		Config.SetPath(*configPath)
 	}
-	logger, err := logConfig.Build()
-	if err != nil {
-		log.Fatal(err)
+	if flag.NArg() > 0 && flag.Arg(0) == "simulate" {
+		simulate(flag.Args()[1:])
+		return
 	}
-	zap.ReplaceGlobals(logger)
-	//setting up enviroment varible containing google authentication credentials file there seems
-	//to be no other way to do this
-	err = os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", config.GoogleServices.CredentialsFile)
-	if err != nil {
-		zap.S().Fatalf("Failed to add needed environment variable GOOGLE_APPLICATION_CREDENTIALS %s", err)
+	if flag.NArg() > 0 && flag.Arg(0) == "validate-config" {
+		validateConfig()
+		return
 	}
 
-	//train language model
-	zap.S().Info("training language model")
-	trainDataFile, err := os.Open("RasaTrainingData/traindata.json")
-	defer trainDataFile.Close()
+	//login and configuration setup
+	//checked before anything starts so every problem is reported together instead of the first one
+	//to break something. the logs are set up first so the token is redacted from the problems
+	config, err := Config.Check(Config.Path())
+	setupLogging(config)
 	if err != nil {
 		zap.S().Fatal(err)
 	}
-	trainDataBytes, err := ioutil.ReadAll(trainDataFile)
-	if err != nil {
+	if config, err = Config.Load(); err != nil {
 		zap.S().Fatal(err)
 	}
+	zap.S().Infof("Loaded config from %s", Config.Path())
+	stopWatchingConfig := make(chan bool)
+	go Config.Watch(configWatchInterval, stopWatchingConfig)
+	trainLanguageModel(config)
+
+	//connect to discord
+	zap.S().Info("Connecting to discord")
+	discord, err := VoiceRecognition.CreateDiscordSession(config.Discord.Token)
+	if err != nil {
+		zap.S().Fatalf("Error opening Discord session: %s", err)
+	}
 
-	trainData := RasaNLU.TrainData{}
-	if err = json.Unmarshal([]byte(trainDataBytes), &trainData); err != nil {
+	speechToText, err := VoiceRecognition.CreateSpeechToText(config)
+	if err != nil {
 		zap.S().Fatal(err)
 	}
-	if err = RasaNLU.Train(config.Rasa.Project, config.Rasa.Language, config.Rasa.Pipeline, trainData); err != nil {
+	textToSpeech, err := VoiceRecognition.CreateTextToSpeech(config)
+	if err != nil {
 		zap.S().Fatal(err)
 	}
+	go prewarmTextToSpeech(textToSpeech, config)
+
+	//slash commands for typing commands and summoning the bot
+	if err := discord.RegisterCommands(config.Discord.Follow); err != nil {
+		zap.S().Fatalf("Failed to register the slash command: %s", err)
+	}
+
+	//interactions are posted to the text channel for guilds with mirroring turned on
+	pipelineEvents := make(chan VoiceRecognition.PipelineEvent)
+	mirror := VoiceRecognition.CreateTextChannelMirror(discord, config, pipelineEvents)
 
 	//start voice recognition
-	cvr := VoiceRecognition.CreateChannelVoiceRecognitionController()
+	//every channel gets its own controller so users in different channels don't affect each other
+	var cvrs []VoiceRecognition.ChannelVoiceRecognitionController
+	var summoner *VoiceRecognition.Summoner
+	if config.Discord.Follow {
+		summons, occupancy := discord.Summons()
+		createVOIPService := func() VoiceRecognition.VOIPService {
+			return discord.VOIPService()
+		}
+		zap.S().Info("Waiting to be summoned to a voice channel")
+		summoner = VoiceRecognition.CreateSummoner(summons, occupancy, createVOIPService, speechToText, textToSpeech, config, pipelineEvents)
+	} else {
+		for _, channel := range config.DiscordChannels() {
+			zap.S().Infof("Starting voice recognition in guild %s voice channel %s", channel.Guild, channel.VoiceChannel)
+			cvr := VoiceRecognition.CreateChannelVoiceRecognitionController(discord.VOIPService(), speechToText, textToSpeech, config, channel.Guild, channel.VoiceChannel, pipelineEvents)
+			cvrs = append(cvrs, cvr)
+		}
+	}
+	findController := func(guildId string, voiceChannelId string) *VoiceRecognition.ChannelVoiceRecognitionController {
+		if summoner != nil {
+			return summoner.Controller(guildId, voiceChannelId)
+		}
+		for i, channel := range config.DiscordChannels() {
+			if channel.Guild == guildId && channel.VoiceChannel == voiceChannelId {
+				return &cvrs[i]
+			}
+		}
+		return nil
+	}
+	//typed commands are read out in the voice channel the user is in if the bot is there too
+	findSpeaker := func(guildId string, voiceChannelId string) VoiceRecognition.VoiceChannelSpeaker {
+		if cvr := findController(guildId, voiceChannelId); cvr != nil {
+			return cvr
+		}
+		return nil
+	}
+	textCommands := VoiceRecognition.CreateTextCommandProcessor(discord.TextCommands(), findSpeaker, config)
+	go VoiceRecognition.RoutePushToTalk(discord.PushToTalkRequests(), findController)
+	go VoiceRecognition.ManagePermissions(discord.PermissionRequests())
+
 	// Closes application on ctrl-c
 	zap.S().Info("Setup Complete")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 	<-sc
 	//closing discord connection
-	complete := cvr.Close()
+	<-textCommands.Close()
+	var completes []chan bool
+	for i := range cvrs {
+		completes = append(completes, cvrs[i].Close())
+	}
+	if summoner != nil {
+		completes = append(completes, summoner.Close())
+	}
 	zap.S().Info("close sent. closing discord connection and cleaning up")
-	<-complete
+	for _, complete := range completes {
+		<-complete
+	}
+	//controllers send to the mirror until they have closed
+	<-mirror.Close()
+	if err := discord.Close(); err != nil {
+		zap.S().Warn(err)
+	}
+	close(stopWatchingConfig)
 	zap.S().Info("finished")
 	zap.S().Sync()
 }
+
+//validateConfig prints every problem with the config and exits with 1 if there are any
+func validateConfig() {
+	if _, err := Config.Check(Config.Path()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("config at %s is valid\n", Config.Path())
+}
+
+func setupLogging(config Config.Config) {
+	logConfig := zap.NewDevelopmentConfig()
+	logConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	logConfig.OutputPaths = []string{"stderr"}
+	//a config that failed to load may not have one
+	if config.Log.Path != "" {
+		logConfig.OutputPaths = append(logConfig.OutputPaths, config.Log.Path)
+	}
+	logger, err := logConfig.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return redactSecrets(core, config.Discord.Token)
+	}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	zap.ReplaceGlobals(logger)
+}
+
+//responses are still synthesized on demand if they aren't ready so this doesn't hold up startup
+func prewarmTextToSpeech(textToSpeech VoiceRecognition.TextToSpeech, config Config.Config) {
+	cache, ok := textToSpeech.(*VoiceRecognition.CachedTextToSpeech)
+	//dialogue prompts are always read out the same way so are worth having ready
+	phrases := append([]string{}, config.TextToSpeech.Cache.Prewarm...)
+	for _, intent := range config.Dialogue.Intents {
+		for _, slot := range intent.Slots {
+			phrases = append(phrases, slot.Prompt)
+		}
+	}
+	if !ok || len(phrases) == 0 {
+		return
+	}
+	if err := cache.Prewarm(context.Background(), phrases); err != nil {
+		zap.S().Warnf("Could not prewarm text to speech cache: %v", err)
+		return
+	}
+	zap.S().Infof("Prewarmed text to speech cache with %d phrases", len(phrases))
+}
+
+func trainLanguageModel(config Config.Config) {
+	zap.S().Info("training language model")
+	trainData, err := RasaNLU.LoadTrainData(config.Rasa.TrainingData)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	if err = RasaNLU.Train(config.Rasa.Project, config.Rasa.Language, config.Rasa.Pipeline, trainData); err != nil {
+		zap.S().Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+//redactingCore replaces secrets like the discord token in everything logged, including errors from
+//libraries that put the token in urls or headers
+type redactingCore struct {
+	zapcore.Core
+	replacer *strings.Replacer
+}
+
+func redactSecrets(core zapcore.Core, secrets ...string) zapcore.Core {
+	var replacements []string
+	for _, secret := range secrets {
+		if secret != "" {
+			replacements = append(replacements, secret, redacted)
+		}
+	}
+	if len(replacements) == 0 {
+		return core
+	}
+	return &redactingCore{Core: core, replacer: strings.NewReplacer(replacements...)}
+}
+
+func (rc *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: rc.Core.With(rc.redactFields(fields)), replacer: rc.replacer}
+}
+
+func (rc *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if rc.Enabled(entry.Level) {
+		return checked.AddCore(entry, rc)
+	}
+	return checked
+}
+
+func (rc *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = rc.replacer.Replace(entry.Message)
+	return rc.Core.Write(entry, rc.redactFields(fields))
+}
+
+func (rc *redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactedFields := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = rc.replacer.Replace(field.String)
+		case zapcore.ErrorType, zapcore.StringerType, zapcore.ReflectType:
+			field = zap.String(field.Key, rc.replacer.Replace(fmt.Sprint(field.Interface)))
+		}
+		redactedFields[i] = field
+	}
+	return redactedFields
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(redactSecrets(core, "secret-token")).With(zap.String("auth", "Bot secret-token"))
+	logger.Sugar().Infof("connecting with %s", "secret-token")
+	logger.Warn("failed", zap.Error(errors.New("bad token secret-token")))
+
+	for _, entry := range logs.All() {
+		if strings.Contains(entry.Message, "secret-token") {
+			t.Errorf("token in message %q", entry.Message)
+		}
+		for key, value := range entry.ContextMap() {
+			if strings.Contains(value.(string), "secret-token") {
+				t.Errorf("token in field %s %q", key, value)
+			}
+		}
+	}
+	if len(logs.All()) != 2 {
+		t.Errorf("expected both entries to be logged got %d", len(logs.All()))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"DiscordVoiceRecognition/Config"
+	"DiscordVoiceRecognition/VoiceRecognition"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const simulateUsage = `usage: simulate [flags] [userid=]file.wav ...
+
+Replays wave files through the full pipeline without discord and prints a timeline of
+detected keyphrases, transcripts, intents and remote bot responses. Files are spoken in
+order. Prefix a file with a user id to speak it as that user, otherwise it is spoken
+by "simulated".
+
+flags:
+`
+
+type simulatedUtterance struct {
+	userId string
+	path   string
+	wave   []byte
+}
+
+//simulate replays recordings through keyphrase recognition, command recognition, rasa and the
+//remote bot using a fake voip service in place of discord
+func simulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	realtime := flags.Bool("realtime", true, "send opus frames every 20ms like discord instead of as fast as possible")
+	gap := flags.Duration("gap", 2*time.Second, "pause between files")
+	idle := flags.Duration("idle", 10*time.Second, "stop once the pipeline has been quiet this long after the last file")
+	train := flags.Bool("train", false, "train the rasa model before simulating")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), simulateUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	utterances, err := loadSimulatedUtterances(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	config, err := Config.Load()
+	setupLogging(config)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	if *train {
+		trainLanguageModel(config)
+	}
+
+	speechToText, err := VoiceRecognition.CreateSpeechToText(config)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	textToSpeech, err := VoiceRecognition.CreateTextToSpeech(config)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	voip := VoiceRecognition.CreateFakeVOIPService()
+	if *realtime {
+		voip.FrameInterval = 20 * time.Millisecond
+	}
+	pipelineEvents := make(chan VoiceRecognition.PipelineEvent)
+	start := time.Now()
+	//only the first channel is simulated
+	channel := config.DiscordChannels()[0]
+	cvr := VoiceRecognition.CreateChannelVoiceRecognitionController(voip, speechToText, textToSpeech, config, channel.Guild, channel.VoiceChannel, pipelineEvents)
+
+	spoken := make(chan bool)
+	go func() {
+		ssrcs := make(map[string]uint32)
+		for _, utterance := range utterances {
+			ssrc, exists := ssrcs[utterance.userId]
+			if !exists {
+				ssrc = uint32(len(ssrcs) + 1)
+				ssrcs[utterance.userId] = ssrc
+				voip.AddSpeaker(ssrc, VoiceRecognition.VOIPUser{Id: utterance.userId, Username: utterance.userId})
+			}
+			fmt.Printf("[%8.3fs] %-12s %-10s %s\n", time.Since(start).Seconds(), utterance.userId, "speaking", utterance.path)
+			if err := voip.SpeakWave(ssrc, utterance.wave); err != nil {
+				zap.S().Warnf("failed to speak %s: %s", utterance.path, err)
+			}
+			time.Sleep(*gap)
+		}
+		spoken <- true
+	}()
+
+	//keep printing until every file has been spoken and nothing has happened for the idle time
+	idleTimer := time.NewTimer(*idle)
+	finishedSpeaking := false
+	for {
+		select {
+		case event := <-pipelineEvents:
+			fmt.Printf("[%8.3fs] %-12s %-10s %s\n", event.Time.Sub(start).Seconds(), event.UserId, event.Type, describePipelineEvent(event))
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(*idle)
+		case <-spoken:
+			finishedSpeaking = true
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(*idle)
+		case <-idleTimer.C:
+			if !finishedSpeaking {
+				idleTimer.Reset(*idle)
+				continue
+			}
+			complete := cvr.Close()
+			//events can still be in flight while closing
+			for {
+				select {
+				case event := <-pipelineEvents:
+					fmt.Printf("[%8.3fs] %-12s %-10s %s\n", event.Time.Sub(start).Seconds(), event.UserId, event.Type, describePipelineEvent(event))
+				case <-complete:
+					zap.S().Sync()
+					return
+				}
+			}
+		}
+	}
+}
+
+func loadSimulatedUtterances(args []string) ([]simulatedUtterance, error) {
+	var utterances []simulatedUtterance
+	for _, arg := range args {
+		utterance := simulatedUtterance{userId: "simulated", path: arg}
+		if i := strings.Index(arg, "="); i > 0 {
+			utterance.userId = arg[:i]
+			utterance.path = arg[i+1:]
+		}
+		wave, err := ioutil.ReadFile(utterance.path)
+		if err != nil {
+			return nil, err
+		}
+		utterance.wave = wave
+		utterances = append(utterances, utterance)
+	}
+	return utterances, nil
+}
+
+func describePipelineEvent(event VoiceRecognition.PipelineEvent) string {
+	switch event.Type {
+	case VoiceRecognition.KeyPhraseDetected, VoiceRecognition.CommandTranscribed, VoiceRecognition.SlotPrompted:
+		return fmt.Sprintf("%q", event.Text)
+	case VoiceRecognition.IntentParsed:
+		var entities []string
+		for _, entity := range event.ParserResponse.Entities {
+			entities = append(entities, fmt.Sprintf("%s=%q", entity.Entity, entity.Value))
+		}
+		sort.Strings(entities)
+		return fmt.Sprintf("%s (%.2f) %s", event.ParserResponse.Intent.Name, event.ParserResponse.Intent.Confidence, strings.Join(entities, " "))
+	case VoiceRecognition.RemoteBotResponded:
+		return fmt.Sprintf("%q understood=%t expect_reply=%t", event.RemoteBotResponse.Text, event.RemoteBotResponse.Understood, event.RemoteBotResponse.ExpectReply)
+	case VoiceRecognition.CommandFailed:
+		return event.Err.Error()
+	case VoiceRecognition.SessionStateChanged:
+		return fmt.Sprintf("%s -> %s on %s", event.Transition.From, event.Transition.To, event.Transition.Event)
+	}
+	return ""
+}